@@ -0,0 +1,118 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"github.com/astaxie/beego/logs"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+//Entry 一个文件或数据源的读取进度
+type Entry struct {
+	Offset  int64     `json:"offset,omitempty"`
+	Cursor  string    `json:"cursor,omitempty"`
+	Done    bool      `json:"done,omitempty"`
+	Updated time.Time `json:"updated"`
+	//文件的inode和设备号,恢复时不一致说明文件已经被替换
+	Inode uint64 `json:"inode,omitempty"`
+	Dev   uint64 `json:"dev,omitempty"`
+}
+
+//store 保存在本地json文件中的进度,定时写盘
+type store struct {
+	lk      sync.Mutex
+	path    string
+	entries map[string]Entry
+	//每次修改加一,写盘成功后记录写入的版本,两者不同时需要写盘
+	version uint64
+	saved   uint64
+	//定时保存和手动保存不同时写临时文件
+	saveLk sync.Mutex
+}
+
+var (
+	cp = &store{entries: make(map[string]Entry)}
+)
+
+//Init 加载进度文件并启动定时保存
+func Init(path string, interval time.Duration) error {
+	cp.lk.Lock()
+	cp.path = path
+	data, err := ioutil.ReadFile(path)
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, &cp.entries)
+	}
+	cp.lk.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := Save(); err != nil {
+				logs.Error("save checkpoint failed,err:%v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+//Get 获取进度
+func Get(key string) (Entry, bool) {
+	cp.lk.Lock()
+	defer cp.lk.Unlock()
+	e, ok := cp.entries[key]
+	return e, ok
+}
+
+//Set 更新进度,在下一次定时保存时写盘
+func Set(key string, e Entry) {
+	e.Updated = time.Now()
+	cp.lk.Lock()
+	cp.entries[key] = e
+	cp.version++
+	cp.lk.Unlock()
+}
+
+//Delete 删除不再需要的进度,比如已经删除的容器日志
+func Delete(key string) {
+	cp.lk.Lock()
+	if _, ok := cp.entries[key]; ok {
+		delete(cp.entries, key)
+		cp.version++
+	}
+	cp.lk.Unlock()
+}
+
+//Save 有更新时写盘,先写临时文件再改名,避免写一半时退出
+//写盘失败时保留更新标记,下一次保存时重试
+func Save() error {
+	cp.saveLk.Lock()
+	defer cp.saveLk.Unlock()
+
+	cp.lk.Lock()
+	if cp.version == cp.saved || len(cp.path) == 0 {
+		cp.lk.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(cp.entries, "", "\t")
+	version, path := cp.version, cp.path
+	cp.lk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	cp.lk.Lock()
+	cp.saved = version
+	cp.lk.Unlock()
+	return nil
+}
@@ -0,0 +1,111 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+	if err := Init(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := map[string]Entry{
+		"file:/var/log/app.log": {Offset: 1024, Inode: 42, Dev: 2049},
+		"journal:system":        {Cursor: "s=abc;i=1"},
+		"archive:deadbeef:10":   {Done: true},
+	}
+	for key, e := range entries {
+		Set(key, e)
+	}
+	Set("file:/var/log/removed.log", Entry{Offset: 1})
+	Delete("file:/var/log/removed.log")
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重新加载后内容一致
+	cp = &store{entries: make(map[string]Entry)}
+	if err := Init(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range entries {
+		got, ok := Get(key)
+		if !ok {
+			t.Errorf("%s not found after reload", key)
+			continue
+		}
+		if got.Offset != want.Offset || got.Inode != want.Inode || got.Dev != want.Dev ||
+			got.Cursor != want.Cursor || got.Done != want.Done || got.Updated.IsZero() {
+			t.Errorf("%s = %+v, want %+v", key, got, want)
+		}
+	}
+	if _, ok := Get("file:/var/log/removed.log"); ok {
+		t.Error("deleted entry loaded")
+	}
+}
+
+func TestInitInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+	if err := ioutil.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cp = &store{entries: make(map[string]Entry)}
+	if err := Init(path, time.Hour); err == nil {
+		t.Error("expect error for broken checkpoint file")
+	}
+}
+
+//TestSaveRetry 写盘失败后不丢掉更新,下一次保存时重试
+func TestSaveRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	//所在目录还不存在,写临时文件失败
+	path := filepath.Join(dir, "missing", "checkpoint.json")
+	cp = &store{entries: make(map[string]Entry)}
+	if err := Init(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	Set("file:/var/log/app.log", Entry{Offset: 10})
+	if err := Save(); err == nil {
+		t.Fatal("expect error when the directory does not exist")
+	}
+
+	if err := os.Mkdir(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `"offset": 10`) {
+		t.Fatalf("checkpoint file = %s, err %v", data, err)
+	}
+
+	//写盘成功后没有新的更新时不再写
+	os.Remove(path)
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("checkpoint rewritten without changes")
+	}
+}
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"io/ioutil"
+	"logagent/metrics"
+	"logagent/module"
+	"logagent/process"
+	"logagent/queue"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	//常驻命令退出后重新启动的间隔
+	restartBackoff = 5 * time.Second
+	//定时命令超时后等待输出结束的时间
+	waitDelay = time.Second
+	//单行输出的最大长度
+	maxLineSize = 1 << 20
+)
+
+//input 一个exec收集任务,命令输出的每一行是一条消息
+type input struct {
+	conf  module.CollectConf
+	chain *process.Chain
+}
+
+//InitCommand 启动input为exec的收集任务
+func InitCommand(config *module.Config) error {
+	for _, v := range config.Collect {
+		if v.Input != "exec" {
+			continue
+		}
+		q, err := queue.Register(v)
+		if err != nil {
+			logs.Error("register queue failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		chain, err := process.New(v, q.Put)
+		if err != nil {
+			logs.Error("init process chain failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		in := &input{conf: v, chain: chain}
+		if v.ExecInterval > 0 {
+			go in.runInterval(context.Background())
+		} else {
+			go in.runForever(context.Background())
+		}
+	}
+	return nil
+}
+
+//runInterval 定时运行命令,运行时间不能超过间隔,避免同时运行多个,ctx结束时停止
+func (in *input) runInterval(ctx context.Context) {
+	for {
+		start := time.Now()
+		runCtx, cancel := context.WithTimeout(ctx, in.conf.ExecInterval)
+		in.run(runCtx)
+		cancel()
+		if !sleep(ctx, in.conf.ExecInterval-time.Since(start)) {
+			return
+		}
+	}
+}
+
+//runForever 常驻命令,退出后重新启动,ctx结束时杀掉命令并停止
+func (in *input) runForever(ctx context.Context) {
+	for {
+		in.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logs.Warn("command exited,restart after %v,task:%s", restartBackoff, in.conf.Name)
+		metrics.Inc("exec."+in.conf.Name+".restarts", 1)
+		if !sleep(ctx, restartBackoff) {
+			return
+		}
+	}
+}
+
+//sleep 等待d,ctx先结束时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+//run 运行一次命令,stdout的每一行发送出去,stderr写到日志中
+func (in *input) run(ctx context.Context) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", in.conf.Command)
+	//超时杀掉sh后,后台的子进程可能还占着输出,等待waitDelay后不再读取
+	cmd.WaitDelay = waitDelay
+	stdout, stdoutW := io.Pipe()
+	stderr, stderrW := io.Pipe()
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	if err := cmd.Start(); err != nil {
+		logs.Error("start command failed,task:%s,command:%s,err:%v", in.conf.Name, in.conf.Command, err)
+		metrics.Inc("exec."+in.conf.Name+".errors", 1)
+		return
+	}
+
+	waitErr := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		stdoutW.Close()
+		stderrW.Close()
+		waitErr <- err
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanLines(stderr, func(line string) {
+			logs.Warn("command stderr,task:%s,line:%s", in.conf.Name, line)
+		})
+	}()
+	scanLines(stdout, func(line string) {
+		in.chain.Process(&module.TextMsg{
+			Msg:    line,
+			Topic:  in.conf.Topic,
+			Source: in.conf.Command,
+		})
+	})
+	<-done
+
+	if err := <-waitErr; err != nil {
+		logs.Warn("command failed,task:%s,command:%s,err:%v", in.conf.Name, in.conf.Command, err)
+		metrics.Inc("exec."+in.conf.Name+".errors", 1)
+	}
+}
+
+func scanLines(r io.Reader, f func(line string)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 {
+			f(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logs.Warn("read command output failed,err:%v", err)
+		//读完剩下的输出,避免命令阻塞在写管道上
+		io.Copy(ioutil.Discard, r)
+	}
+}
@@ -0,0 +1,118 @@
+package command
+
+import (
+	"context"
+	"logagent/module"
+	"logagent/process"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//collector 记录处理链输出的消息
+type collector struct {
+	lk    sync.Mutex
+	lines []string
+}
+
+func (c *collector) put(msg *module.TextMsg) {
+	c.lk.Lock()
+	c.lines = append(c.lines, msg.Msg)
+	c.lk.Unlock()
+}
+
+func (c *collector) get() []string {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return append([]string(nil), c.lines...)
+}
+
+func newTestInput(t *testing.T, conf module.CollectConf) (*input, *collector) {
+	c := &collector{}
+	chain, err := process.New(conf, c.put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &input{conf: conf, chain: chain}, c
+}
+
+//runUntil 运行f直到ctx结束,返回ctx结束后f退出用了多久
+func runUntil(t *testing.T, d time.Duration, f func(ctx context.Context)) time.Duration {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan time.Time)
+	go func() {
+		f(ctx)
+		stopped <- time.Now()
+	}()
+	time.Sleep(d)
+	cancel()
+	start := time.Now()
+	select {
+	case end := <-stopped:
+		return end.Sub(start)
+	case <-time.After(5 * time.Second):
+		t.Fatal("not stopped after context canceled")
+		return 0
+	}
+}
+
+//TestRunForever 常驻命令不限制运行时间,stderr不作为消息
+func TestRunForever(t *testing.T) {
+	in, c := newTestInput(t, module.CollectConf{
+		Name:    "exec",
+		Topic:   "exec",
+		Command: `printf 'a\n'; printf 'oops\n' >&2; sleep 0.3; printf 'b\r\n\nc'`,
+	})
+	//命令结束后等待restartBackoff,取消时立即退出
+	if d := runUntil(t, time.Second, in.runForever); d > time.Second {
+		t.Errorf("stopped after %v", d)
+	}
+	if got, want := c.get(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+//TestRunInterval 按间隔重复运行,超过间隔的命令被杀掉
+func TestRunInterval(t *testing.T) {
+	in, c := newTestInput(t, module.CollectConf{
+		Name:         "exec",
+		Topic:        "exec",
+		Command:      `printf 'tick\n'`,
+		ExecInterval: 200 * time.Millisecond,
+	})
+	runUntil(t, 700*time.Millisecond, in.runInterval)
+	if n := len(c.get()); n < 2 || n > 4 {
+		t.Errorf("ran %d times in 700ms with 200ms interval", n)
+	}
+
+	in, c = newTestInput(t, module.CollectConf{
+		Name:         "exec",
+		Topic:        "exec",
+		Command:      `printf 'a\n'; sleep 0.5; printf 'b\n'`,
+		ExecInterval: 200 * time.Millisecond,
+	})
+	runUntil(t, 300*time.Millisecond, in.runInterval)
+	if got := c.get(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("lines = %q, want [a]", got)
+	}
+}
+
+//TestRunWaitDelay 杀掉sh后,后台子进程还占着输出时最多再等waitDelay
+func TestRunWaitDelay(t *testing.T) {
+	in, c := newTestInput(t, module.CollectConf{
+		Name:    "exec",
+		Topic:   "exec",
+		Command: `printf 'a\n'; (sleep 5; printf 'late\n') & wait`,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	in.run(ctx)
+	if d := time.Since(start); d > 200*time.Millisecond+waitDelay+time.Second {
+		t.Errorf("run returned after %v", d)
+	}
+	if got := c.get(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("lines = %q, want [a]", got)
+	}
+}
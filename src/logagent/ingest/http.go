@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"io/ioutil"
+	"logagent/metrics"
+	"net/http"
+	"strings"
+)
+
+//httpHandler 接收POST的日志,请求体每行一条消息,可以是普通文本或ndjson
+type httpHandler struct {
+	task *task
+}
+
+type ingestResult struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conf := h.task.conf
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		reply(w, http.StatusMethodNotAllowed, ingestResult{Error: "method not allowed"})
+		return
+	}
+	if len(conf.HTTPToken) > 0 && !authorized(r, conf.HTTPToken) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		reply(w, http.StatusUnauthorized, ingestResult{Error: "unauthorized"})
+		return
+	}
+	if r.ContentLength > conf.MaxBodySize {
+		reply(w, http.StatusRequestEntityTooLarge, ingestResult{Error: "body too large"})
+		return
+	}
+
+	topic := r.URL.Query().Get("topic")
+	if len(topic) > 0 && topic != conf.Topic && !contains(conf.AllowedTopics, topic) {
+		reply(w, http.StatusForbidden, ingestResult{Error: "topic not allowed:" + topic})
+		return
+	}
+
+	//先读完整个请求体,超出大小时不接收其中任何一行
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(io.LimitReader(r.Body, conf.MaxBodySize+1))
+		if err != nil {
+			reply(w, http.StatusBadRequest, ingestResult{Error: "invalid gzip body"})
+			return
+		}
+		defer gz.Close()
+		//解压后的大小同样受限制
+		body = gz
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, conf.MaxBodySize+1))
+	if err != nil {
+		reply(w, http.StatusBadRequest, ingestResult{Error: fmt.Sprintf("read body failed:%v", err)})
+		return
+	}
+	if int64(len(data)) > conf.MaxBodySize {
+		reply(w, http.StatusRequestEntityTooLarge, ingestResult{Error: "body too large"})
+		return
+	}
+
+	lines, size := splitLines(string(data))
+	//整个请求一起限速,超出时一行都不接收,客户端可以原样重试而不会重复
+	source := r.RemoteAddr
+	if !h.task.clients.get(hostOf(source)).AllowN(len(lines), size) {
+		metrics.Inc("ingest."+conf.Name+".rate_limited", 1)
+		reply(w, http.StatusTooManyRequests, ingestResult{Error: "rate limited"})
+		return
+	}
+	for _, line := range lines {
+		h.task.emit(line, source, topic)
+	}
+	metrics.Inc("ingest."+conf.Name+".requests", 1)
+	reply(w, http.StatusOK, ingestResult{Accepted: len(lines)})
+}
+
+//splitLines 按行拆分请求体,去掉空行,同时返回总字节数
+func splitLines(data string) ([]string, int) {
+	var lines []string
+	size := 0
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+		size += len(line)
+	}
+	return lines, size
+}
+
+//authorized 校验Authorization: Bearer <token>
+func authorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) == 1
+}
+
+func reply(w http.ResponseWriter, status int, result ingestResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logs.Warn("write ingest response failed,err:%v", err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.TrimSpace(v) == s {
+			return true
+		}
+	}
+	return false
+}
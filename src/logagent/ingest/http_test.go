@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"logagent/module"
+	"logagent/process"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//collector 记录处理链输出的消息
+type collector struct {
+	lk   sync.Mutex
+	msgs []*module.TextMsg
+}
+
+func (c *collector) put(msg *module.TextMsg) {
+	c.lk.Lock()
+	c.msgs = append(c.msgs, msg)
+	c.lk.Unlock()
+}
+
+func (c *collector) lines() []string {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	var lines []string
+	for _, msg := range c.msgs {
+		lines = append(lines, msg.Msg)
+	}
+	return lines
+}
+
+func newTestTask(t *testing.T, conf module.CollectConf) (*task, *collector) {
+	c := &collector{}
+	chain, err := process.New(conf, c.put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &task{conf: conf, chain: chain, clients: newClientLimits(conf.ConnRateLines, conf.ConnRateBytes)}, c
+}
+
+func gzipped(s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+func TestHTTPHandler(t *testing.T) {
+	base := module.CollectConf{Name: "http", Input: "http", Topic: "app", MaxBodySize: 64, AllowedTopics: []string{"job"}}
+	tests := []struct {
+		name   string
+		conf   func(*module.CollectConf)
+		method string
+		url    string
+		header map[string]string
+		body   string
+		status int
+		lines  []string
+		topic  string
+	}{
+		{name: "newline split", body: "a\r\nb\n\n{\"c\":1}\n", status: 200, lines: []string{"a", "b", `{"c":1}`}, topic: "app"},
+		{name: "no trailing newline", body: "a\nb", status: 200, lines: []string{"a", "b"}, topic: "app"},
+		{name: "allowed topic", url: "/?topic=job", body: "a", status: 200, lines: []string{"a"}, topic: "job"},
+		{name: "topic not allowed", url: "/?topic=other", body: "a", status: 403},
+		{name: "method", method: "GET", status: 405},
+		{name: "gzip", header: map[string]string{"Content-Encoding": "gzip"}, body: gzipped("a\nb\n"), status: 200, lines: []string{"a", "b"}, topic: "app"},
+		{name: "invalid gzip", header: map[string]string{"Content-Encoding": "gzip"}, body: "a", status: 400},
+		{name: "body too large", body: strings.Repeat("a\n", 40), status: 413},
+		//解压前不大,解压后超过max_body_size
+		{name: "gzip too large", header: map[string]string{"Content-Encoding": "gzip"}, body: gzipped(strings.Repeat("a\n", 40)), status: 413},
+		{
+			name:   "token",
+			conf:   func(c *module.CollectConf) { c.HTTPToken = "secret" },
+			header: map[string]string{"Authorization": "Bearer secret"},
+			body:   "a", status: 200, lines: []string{"a"}, topic: "app",
+		},
+		{name: "missing token", conf: func(c *module.CollectConf) { c.HTTPToken = "secret" }, body: "a", status: 401},
+		{
+			name:   "wrong token",
+			conf:   func(c *module.CollectConf) { c.HTTPToken = "secret" },
+			header: map[string]string{"Authorization": "Bearer other"},
+			body:   "a", status: 401,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := base
+			if tt.conf != nil {
+				tt.conf(&conf)
+			}
+			task, c := newTestTask(t, conf)
+			method, url := tt.method, tt.url
+			if len(method) == 0 {
+				method = "POST"
+			}
+			if len(url) == 0 {
+				url = "/"
+			}
+			r := httptest.NewRequest(method, url, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			(&httpHandler{task: task}).ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body:%s", w.Code, tt.status, w.Body.String())
+			}
+			var result ingestResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Accepted != len(tt.lines) {
+				t.Errorf("accepted = %d, want %d", result.Accepted, len(tt.lines))
+			}
+			if got := c.lines(); !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+			for _, msg := range c.msgs {
+				if msg.Topic != tt.topic || msg.Source != r.RemoteAddr {
+					t.Errorf("topic = %s, source = %s, want %s, %s", msg.Topic, msg.Source, tt.topic, r.RemoteAddr)
+				}
+			}
+		})
+	}
+}
+
+//TestHTTPRateLimit 超出限速时整个请求返回429,不接收其中任何一行,重试时不会重复
+func TestHTTPRateLimit(t *testing.T) {
+	task, c := newTestTask(t, module.CollectConf{Name: "http", Input: "http", Topic: "app", MaxBodySize: 1024, ConnRateLines: 3})
+	h := &httpHandler{task: task}
+	post := func(body, addr string) int {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := post("a\nb\n", "10.0.0.1:1000"); code != http.StatusOK {
+		t.Fatalf("first request status = %d", code)
+	}
+	//只剩1行的额度,请求有2行
+	if code := post("c\nd\n", "10.0.0.1:1001"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want 429", code)
+	}
+	if got := c.lines(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("lines = %q, partial batch must not be emitted", got)
+	}
+	//其他客户端单独限速
+	if code := post("e\n", "10.0.0.2:1000"); code != http.StatusOK {
+		t.Errorf("other client status = %d", code)
+	}
+}
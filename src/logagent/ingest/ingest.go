@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"logagent/module"
+	"logagent/process"
+	"logagent/queue"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	//客户端限速状态空闲多久后清理
+	clientIdle = time.Minute
+)
+
+//task 一个socket或http收集任务
+type task struct {
+	conf  module.CollectConf
+	lk    sync.Mutex
+	chain *process.Chain
+	//udp和http没有长连接,按客户端地址限速
+	clients *clientLimits
+}
+
+var (
+	handlers = make(map[string]http.Handler)
+)
+
+//InitIngest 启动input为socket和http的收集任务
+func InitIngest(config *module.Config) error {
+	for _, v := range config.Collect {
+		if v.Input != "socket" && v.Input != "http" {
+			continue
+		}
+		q, err := queue.Register(v)
+		if err != nil {
+			logs.Error("register queue failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		chain, err := process.New(v, q.Put)
+		if err != nil {
+			logs.Error("init process chain failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		t := &task{
+			conf:    v,
+			chain:   chain,
+			clients: newClientLimits(v.ConnRateLines, v.ConnRateBytes),
+		}
+
+		if v.Input == "socket" {
+			if err = t.listen(); err != nil {
+				logs.Error("listen socket failed,task:%s,listen:%s,err:%v", v.Name, v.Listen, err)
+				return err
+			}
+			logs.Info("socket input listen on %s,task:%s", v.Listen, v.Name)
+			continue
+		}
+		if _, ok := handlers[v.HTTPPath]; ok {
+			return fmt.Errorf("duplicate http_path:%s", v.HTTPPath)
+		}
+		handlers[v.HTTPPath] = &httpHandler{task: t}
+	}
+	return nil
+}
+
+//Handlers 返回需要注册到管理接口的http收集任务
+func Handlers() map[string]http.Handler {
+	return handlers
+}
+
+//emit 生成一条消息交给处理链,topic为空时使用任务的topic
+func (t *task) emit(line, source, topic string) {
+	if len(topic) == 0 {
+		topic = t.conf.Topic
+	}
+	msg := &module.TextMsg{
+		Msg:    line,
+		Topic:  topic,
+		Source: source,
+	}
+	//处理链中有状态的processor不支持并发,多个连接依次处理
+	t.lk.Lock()
+	t.chain.Process(msg)
+	t.lk.Unlock()
+}
+
+//clientLimits 按客户端地址保存的限速状态
+type clientLimits struct {
+	lk      sync.Mutex
+	lines   int
+	bytes   int
+	clients map[string]*clientLimit
+	pruned  time.Time
+}
+
+type clientLimit struct {
+	limit *process.RateLimit
+	last  time.Time
+}
+
+func newClientLimits(lines, bytes int) *clientLimits {
+	if lines <= 0 && bytes <= 0 {
+		return nil
+	}
+	return &clientLimits{
+		lines:   lines,
+		bytes:   bytes,
+		clients: make(map[string]*clientLimit),
+		pruned:  time.Now(),
+	}
+}
+
+//get 返回客户端的限速器,顺便清理长时间没有数据的客户端
+func (c *clientLimits) get(client string) *process.RateLimit {
+	if c == nil {
+		return nil
+	}
+	now := time.Now()
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if now.Sub(c.pruned) > clientIdle {
+		for k, v := range c.clients {
+			if now.Sub(v.last) > clientIdle {
+				delete(c.clients, k)
+			}
+		}
+		c.pruned = now
+	}
+	cl, ok := c.clients[client]
+	if !ok {
+		cl = &clientLimit{limit: process.NewRateLimit(c.lines, c.bytes)}
+		c.clients[client] = cl
+	}
+	cl.last = now
+	return cl.limit
+}
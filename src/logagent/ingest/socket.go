@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"logagent/metrics"
+	"logagent/process"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	//单行的最大长度,udp报文不会超过这个大小
+	maxLineSize = 1 << 20
+	maxPacket   = 64 * 1024
+)
+
+//listen 按listen地址监听tcp或udp,每行一条消息
+func (t *task) listen() error {
+	i := strings.Index(t.conf.Listen, "://")
+	if i <= 0 {
+		return fmt.Errorf("invalid listen address:%s", t.conf.Listen)
+	}
+	network, addr := t.conf.Listen[:i], t.conf.Listen[i+3:]
+
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		go t.servePacket(conn)
+	case "tcp":
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		go t.serveStream(ln)
+	default:
+		return fmt.Errorf("unsupported network:%s", network)
+	}
+	return nil
+}
+
+//servePacket 一个udp报文中可以有多行,超出来源地址的限速时丢弃
+func (t *task) servePacket(conn net.PacketConn) {
+	buf := make([]byte, maxPacket)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			logs.Error("read udp packet failed,task:%s,err:%v", t.conf.Name, err)
+			return
+		}
+		source := addr.String()
+		limit := t.clients.get(hostOf(source))
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if len(line) == 0 {
+				continue
+			}
+			if !limit.Allow(len(line)) {
+				metrics.Inc("ingest."+t.conf.Name+".rate_limited", 1)
+				continue
+			}
+			t.emit(line, source, "")
+		}
+	}
+}
+
+func (t *task) serveStream(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			logs.Error("accept connection failed,task:%s,err:%v", t.conf.Name, err)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go t.serveConn(conn)
+	}
+}
+
+//serveConn 每个tcp连接单独限速,超出时暂停读取,由tcp流控让客户端慢下来
+func (t *task) serveConn(conn net.Conn) {
+	defer conn.Close()
+	source := conn.RemoteAddr().String()
+	limit := process.NewRateLimit(t.conf.ConnRateLines, t.conf.ConnRateBytes)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		limit.Wait(len(line))
+		t.emit(line, source, "")
+	}
+	if err := scanner.Err(); err != nil {
+		logs.Warn("read connection failed,task:%s,remote:%s,err:%v", t.conf.Name, source, err)
+	}
+}
+
+//hostOf 去掉地址中的端口
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
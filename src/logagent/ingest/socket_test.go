@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"logagent/module"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//waitLines 等到收到n行或超时
+func waitLines(c *collector, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if lines := c.lines(); len(lines) >= n {
+			return lines
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return c.lines()
+}
+
+func TestServeStream(t *testing.T) {
+	task, c := newTestTask(t, module.CollectConf{Name: "socket", Input: "socket", Topic: "app"})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go task.serveStream(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//一行分在两次写入中,空行跳过
+	conn.Write([]byte("a\r\nb"))
+	time.Sleep(10 * time.Millisecond)
+	conn.Write([]byte("c\n\nd"))
+	conn.Close()
+
+	want := []string{"a", "bc", "d"}
+	if got := waitLines(c, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+	if c.msgs[0].Topic != "app" || len(c.msgs[0].Source) == 0 {
+		t.Errorf("topic = %s, source = %s", c.msgs[0].Topic, c.msgs[0].Source)
+	}
+}
+
+//TestServePacket 一个报文中有多行,超出来源地址的限速时丢弃
+func TestServePacket(t *testing.T) {
+	task, c := newTestTask(t, module.CollectConf{Name: "socket", Input: "socket", Topic: "app", ConnRateLines: 2})
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go task.servePacket(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Write([]byte("a\nb\r\n\nc\n"))
+
+	if got := waitLines(c, 2); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("lines = %q, want [a b]", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := c.lines(); len(got) != 2 {
+		t.Errorf("rate limited line emitted: %q", got)
+	}
+}
@@ -0,0 +1,55 @@
+package journal
+
+import (
+	"logagent/checkpoint"
+	"logagent/module"
+	"sync"
+)
+
+//trackedEntry 一条记录的cursor和处理状态
+type trackedEntry struct {
+	cursor string
+	done   bool
+}
+
+//cursorTracker 按读取顺序跟踪每条记录产生的消息,前面的记录都处理完后才保存cursor,
+//重启后从没有发送完的记录继续读
+type cursorTracker struct {
+	key string
+
+	lk      sync.Mutex
+	pending []*trackedEntry
+}
+
+func newCursorTracker(key string) *cursorTracker {
+	return &cursorTracker{key: key}
+}
+
+//track 记录读到的一条记录,返回的Ack由读取方处理完这条记录后Done
+func (t *cursorTracker) track(cursor string) *module.Ack {
+	te := &trackedEntry{cursor: cursor}
+	t.lk.Lock()
+	t.pending = append(t.pending, te)
+	t.lk.Unlock()
+	return module.NewAck(func() {
+		t.done(te)
+	})
+}
+
+//done 一条记录的消息都处理完,保存前面连续处理完的最后一个cursor
+func (t *cursorTracker) done(te *trackedEntry) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	te.done = true
+	var cursor string
+	n := 0
+	for ; n < len(t.pending) && t.pending[n].done; n++ {
+		if len(t.pending[n].cursor) > 0 {
+			cursor = t.pending[n].cursor
+		}
+	}
+	t.pending = append(t.pending[:0], t.pending[n:]...)
+	if len(cursor) > 0 {
+		checkpoint.Set(t.key, checkpoint.Entry{Cursor: cursor})
+	}
+}
@@ -0,0 +1,65 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	//单个字段的最大长度,超出时认为数据已经损坏
+	maxFieldSize = 16 << 20
+)
+
+//exportReader 读取journalctl -o export格式,每条记录由空行分隔,
+//普通字段为KEY=value,二进制字段为KEY\n加上8字节小端长度和数据
+type exportReader struct {
+	r *bufio.Reader
+}
+
+func newExportReader(r io.Reader) *exportReader {
+	return &exportReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+//Next 读取下一条记录,没有更多记录时返回io.EOF
+func (e *exportReader) Next() (map[string]string, error) {
+	entry := make(map[string]string)
+	for {
+		line, err := e.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && len(entry) > 0 && len(line) == 0 {
+				return entry, nil
+			}
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) == 0 {
+			if len(entry) == 0 {
+				continue
+			}
+			return entry, nil
+		}
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			entry[line[:i]] = line[i+1:]
+			continue
+		}
+
+		var size uint64
+		if err := binary.Read(e.r, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		if size > maxFieldSize {
+			return nil, fmt.Errorf("field %s too large:%d", line, size)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(e.r, data); err != nil {
+			return nil, err
+		}
+		entry[line] = string(data[:size])
+	}
+}
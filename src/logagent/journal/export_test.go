@@ -0,0 +1,81 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//binaryField 二进制字段,KEY\n加上8字节小端长度,数据和换行
+func binaryField(key, value string) string {
+	var buf bytes.Buffer
+	buf.WriteString(key + "\n")
+	binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+	return buf.String()
+}
+
+func TestExportReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		entries []map[string]string
+		err     error
+	}{
+		{
+			"entries",
+			"__CURSOR=s=1\nMESSAGE=hello\n\n__CURSOR=s=2\nMESSAGE=a=b\n\n",
+			[]map[string]string{
+				{"__CURSOR": "s=1", "MESSAGE": "hello"},
+				{"__CURSOR": "s=2", "MESSAGE": "a=b"},
+			},
+			io.EOF,
+		},
+		{
+			"binary field",
+			"__CURSOR=s=1\n" + binaryField("MESSAGE", "line1\nline2") + "PRIORITY=6\n\n",
+			[]map[string]string{{"__CURSOR": "s=1", "MESSAGE": "line1\nline2", "PRIORITY": "6"}},
+			io.EOF,
+		},
+		{
+			//journalctl -f被杀掉时最后一条记录可能没有空行
+			"last entry without blank line",
+			"\n\nMESSAGE=a\n\n\nMESSAGE=b\n",
+			[]map[string]string{{"MESSAGE": "a"}, {"MESSAGE": "b"}},
+			io.EOF,
+		},
+		{"empty", "", nil, io.EOF},
+		{"truncated line", "MESSAGE=a\n\nMESSAGE=b", []map[string]string{{"MESSAGE": "a"}}, io.ErrUnexpectedEOF},
+		{"truncated binary", "MESSAGE\n\x05\x00\x00\x00\x00\x00\x00\x00ab", nil, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newExportReader(strings.NewReader(tt.data))
+			var entries []map[string]string
+			var err error
+			for {
+				var entry map[string]string
+				if entry, err = r.Next(); err != nil {
+					break
+				}
+				entries = append(entries, entry)
+			}
+			if err != tt.err {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("entries = %v, want %v", entries, tt.entries)
+			}
+		})
+	}
+}
+
+func TestExportReaderFieldTooLarge(t *testing.T) {
+	data := "MESSAGE\n\xff\xff\xff\xff\x00\x00\x00\x00"
+	if _, err := newExportReader(strings.NewReader(data)).Next(); err == nil || err == io.EOF {
+		t.Errorf("err = %v, want field too large", err)
+	}
+}
@@ -0,0 +1,286 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"logagent/checkpoint"
+	"logagent/metrics"
+	"logagent/module"
+	"logagent/process"
+	"logagent/queue"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//journalctl退出后重新启动的间隔
+	restartBackoff = 5 * time.Second
+)
+
+var priorityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+//一些常用字段改成更容易使用的名称,其他字段转成小写并去掉开头的下划线
+var fieldNames = map[string]string{
+	"_SYSTEMD_UNIT":     "unit",
+	"_HOSTNAME":         "hostname",
+	"SYSLOG_IDENTIFIER": "app_name",
+	"_PID":              "pid",
+	"SYSLOG_FACILITY":   "facility",
+	"_COMM":             "command",
+}
+
+//input 一个journal收集任务
+type input struct {
+	conf  module.CollectConf
+	chain *process.Chain
+	//unit过滤,为空时不限制
+	units map[string]bool
+	//只保留priority不大于maxPriority的消息
+	maxPriority int
+}
+
+//InitJournal 启动input为journal的收集任务
+func InitJournal(config *module.Config) error {
+	for _, v := range config.Collect {
+		if v.Input != "journal" {
+			continue
+		}
+		in, err := newInput(v)
+		if err != nil {
+			return err
+		}
+		q, err := queue.Register(v)
+		if err != nil {
+			logs.Error("register queue failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		in.chain, err = process.New(v, q.Put)
+		if err != nil {
+			logs.Error("init process chain failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		if len(v.JournalFile) > 0 {
+			go in.readFile()
+		} else {
+			go in.follow()
+		}
+	}
+	return nil
+}
+
+//newInput 按配置生成unit和priority过滤条件,处理链由调用方设置
+func newInput(conf module.CollectConf) (*input, error) {
+	maxPriority, err := parsePriority(conf.JournalPriority)
+	if err != nil {
+		return nil, err
+	}
+	in := &input{
+		conf:        conf,
+		maxPriority: maxPriority,
+	}
+	if len(conf.JournalUnits) > 0 {
+		in.units = make(map[string]bool)
+		for _, u := range conf.JournalUnits {
+			in.units[strings.TrimSpace(u)] = true
+		}
+	}
+	return in, nil
+}
+
+//parsePriority 支持级别名称和0-7的数字,为空时不过滤
+func parsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 0 {
+		return len(priorityNames) - 1, nil
+	}
+	for i, name := range priorityNames {
+		if s == name {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n >= len(priorityNames) {
+		return 0, fmt.Errorf("invalid journal_priority:%s", s)
+	}
+	return n, nil
+}
+
+func (in *input) cursorKey() string {
+	return "journal:" + in.conf.Name
+}
+
+//args journalctl的参数,有cursor时从cursor之后继续,否则按start_position决定
+func (in *input) args() []string {
+	args := []string{"-o", "export", "-f", "--no-pager"}
+	if e, ok := checkpoint.Get(in.cursorKey()); ok && len(e.Cursor) > 0 {
+		args = append(args, "--after-cursor="+e.Cursor)
+	} else {
+		switch in.conf.StartPosition {
+		case "lines":
+			args = append(args, "-n", strconv.FormatInt(in.conf.StartLast, 10))
+		case "end", "bytes":
+			args = append(args, "-n", "0")
+		default:
+			args = append(args, "--no-tail")
+		}
+	}
+	for u := range in.units {
+		args = append(args, "-u", u)
+	}
+	if in.maxPriority < len(priorityNames)-1 {
+		args = append(args, "-p", strconv.Itoa(in.maxPriority))
+	}
+	return args
+}
+
+//follow 运行journalctl -f读取新的日志,退出后从记录的cursor重新启动
+func (in *input) follow() {
+	for {
+		args := in.args()
+		cmd := exec.Command(in.conf.JournalCommand, args...)
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			logs.Error("start journalctl failed,task:%s,err:%v", in.conf.Name, err)
+			time.Sleep(restartBackoff)
+			continue
+		}
+		logs.Info("journalctl started,task:%s,args:%v", in.conf.Name, args)
+
+		err = in.read(stdout, "")
+		if err != nil && err != io.EOF {
+			logs.Error("read journal failed,task:%s,err:%v", in.conf.Name, err)
+		}
+		cmd.Process.Kill()
+		err = cmd.Wait()
+		logs.Warn("journalctl exited,restart later,task:%s,err:%v", in.conf.Name, err)
+		metrics.Inc("journal."+in.conf.Name+".restarts", 1)
+		time.Sleep(restartBackoff)
+	}
+}
+
+//readFile 读取保存下来的export文件,从记录的cursor之后开始
+func (in *input) readFile() {
+	path := in.conf.JournalFile
+	var skipTo string
+	if e, ok := checkpoint.Get(in.cursorKey()); ok && len(e.Cursor) > 0 && in.hasCursor(path, e.Cursor) {
+		skipTo = e.Cursor
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		logs.Error("open journal file failed,task:%s,path:%s,err:%v", in.conf.Name, path, err)
+		return
+	}
+	defer file.Close()
+	err = in.read(file, skipTo)
+	if err != nil && err != io.EOF {
+		logs.Error("read journal file failed,task:%s,path:%s,err:%v", in.conf.Name, path, err)
+		return
+	}
+	if err = checkpoint.Save(); err != nil {
+		logs.Error("save checkpoint failed,err:%v", err)
+	}
+	logs.Info("journal file done,task:%s,path:%s", in.conf.Name, path)
+}
+
+//hasCursor 文件中是否有记录的cursor,没有时说明是另一个文件,需要从头读
+func (in *input) hasCursor(path, cursor string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	r := newExportReader(file)
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return false
+		}
+		if entry["__CURSOR"] == cursor {
+			return true
+		}
+	}
+}
+
+//read 依次处理每条记录,skipTo不为空时跳过该cursor及之前的记录
+func (in *input) read(r io.Reader, skipTo string) error {
+	reader := newExportReader(r)
+	tracker := newCursorTracker(in.cursorKey())
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		cursor := entry["__CURSOR"]
+		if len(skipTo) > 0 {
+			if cursor == skipTo {
+				skipTo = ""
+			}
+			continue
+		}
+		//消息发送完后才保存cursor,过滤掉的记录直接确认
+		ack := tracker.track(cursor)
+		if in.accept(entry) {
+			msg := in.message(entry)
+			msg.Ack = ack
+			in.chain.Process(msg)
+		}
+		ack.Done()
+	}
+}
+
+//accept 按unit和priority过滤
+func (in *input) accept(entry map[string]string) bool {
+	if in.units != nil && !in.units[entry["_SYSTEMD_UNIT"]] {
+		return false
+	}
+	if p, err := strconv.Atoi(entry["PRIORITY"]); err == nil && p > in.maxPriority {
+		return false
+	}
+	return true
+}
+
+//message 把journal字段转成消息,MESSAGE作为正文,__REALTIME_TIMESTAMP作为事件时间
+func (in *input) message(entry map[string]string) *module.TextMsg {
+	msg := &module.TextMsg{
+		Msg:    entry["MESSAGE"],
+		Topic:  in.conf.Topic,
+		Source: "journal",
+	}
+	if len(in.conf.JournalFile) > 0 {
+		msg.Source = in.conf.JournalFile
+	}
+	if usec, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		msg.Time = time.Unix(0, usec*int64(time.Microsecond))
+	}
+	for k, v := range entry {
+		//__开头的是cursor和时间等内部字段
+		if strings.HasPrefix(k, "__") || k == "MESSAGE" {
+			continue
+		}
+		switch name, ok := fieldNames[k]; {
+		case ok:
+			msg.SetField(name, v)
+		case k == "PRIORITY":
+			if p, err := strconv.Atoi(v); err == nil && p >= 0 && p < len(priorityNames) {
+				msg.SetField("priority", p)
+				msg.SetField("severity", priorityNames[p])
+			}
+		default:
+			msg.SetField(strings.ToLower(strings.TrimLeft(k, "_")), v)
+		}
+	}
+	if msg.Fields == nil {
+		msg.SetField("message", msg.Msg)
+	}
+	return msg
+}
@@ -0,0 +1,166 @@
+package journal
+
+import (
+	"io"
+	"logagent/checkpoint"
+	"logagent/module"
+	"logagent/process"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		name     string
+		units    []string
+		priority string
+		entry    map[string]string
+		want     bool
+	}{
+		{"no filter", nil, "", map[string]string{"PRIORITY": "7"}, true},
+		{"unit match", []string{"nginx.service", "sshd.service"}, "", map[string]string{"_SYSTEMD_UNIT": "sshd.service"}, true},
+		{"unit mismatch", []string{"nginx.service"}, "", map[string]string{"_SYSTEMD_UNIT": "cron.service"}, false},
+		{"no unit", []string{"nginx.service"}, "", map[string]string{"MESSAGE": "kernel"}, false},
+		{"priority equal", nil, "warning", map[string]string{"PRIORITY": "4"}, true},
+		{"priority higher", nil, "warning", map[string]string{"PRIORITY": "2"}, true},
+		{"priority lower", nil, "4", map[string]string{"PRIORITY": "6"}, false},
+		//没有PRIORITY字段时不过滤
+		{"no priority", nil, "err", map[string]string{"MESSAGE": "x"}, true},
+		{"unit and priority", []string{"nginx.service"}, "err", map[string]string{"_SYSTEMD_UNIT": "nginx.service", "PRIORITY": "6"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newTestInput(t, module.CollectConf{Name: "journal", JournalUnits: tt.units, JournalPriority: tt.priority})
+			if got := in.accept(tt.entry); got != tt.want {
+				t.Errorf("accept = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+		err  bool
+	}{
+		{"", 7, false},
+		{"emerg", 0, false},
+		{" Warning ", 4, false},
+		{"3", 3, false},
+		{"8", 0, true},
+		{"-1", 0, true},
+		{"fatal", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePriority(tt.s)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parsePriority(%q) = %d, %v, want %d, error %v", tt.s, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		conf   module.CollectConf
+		cursor string
+		want   string
+	}{
+		{"beginning", module.CollectConf{}, "", "-o export -f --no-pager --no-tail"},
+		{"end", module.CollectConf{StartPosition: "end"}, "", "-o export -f --no-pager -n 0"},
+		{"last lines", module.CollectConf{StartPosition: "lines", StartLast: 100}, "", "-o export -f --no-pager -n 100"},
+		//有cursor时忽略start_position
+		{"cursor", module.CollectConf{StartPosition: "end"}, "s=abc", "-o export -f --no-pager --after-cursor=s=abc"},
+		{
+			"unit and priority",
+			module.CollectConf{JournalUnits: []string{" nginx.service "}, JournalPriority: "err"},
+			"",
+			"-o export -f --no-pager --no-tail -u nginx.service -p 3",
+		},
+		{"debug priority not passed", module.CollectConf{JournalPriority: "debug"}, "", "-o export -f --no-pager --no-tail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Name = "args_" + tt.name
+			in := newTestInput(t, tt.conf)
+			if len(tt.cursor) > 0 {
+				checkpoint.Set(in.cursorKey(), checkpoint.Entry{Cursor: tt.cursor})
+				defer checkpoint.Delete(in.cursorKey())
+			}
+			if got := strings.Join(in.args(), " "); got != tt.want {
+				t.Errorf("args = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+//TestReadCursor cursor在消息发送完后才保存,只推进到连续发送完的记录
+func TestReadCursor(t *testing.T) {
+	var msgs []*module.TextMsg
+	conf := module.CollectConf{Name: "cursor", Topic: "journal", JournalPriority: "warning"}
+	in := newTestInput(t, conf)
+	chain, err := process.New(conf, func(msg *module.TextMsg) {
+		msg.Ack.Add()
+		msgs = append(msgs, msg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.chain = chain
+	defer checkpoint.Delete(in.cursorKey())
+
+	data := "__CURSOR=c1\nMESSAGE=one\nPRIORITY=3\n\n" +
+		"__CURSOR=c2\nMESSAGE=filtered\nPRIORITY=6\n\n" +
+		"__CURSOR=c3\nMESSAGE=three\nPRIORITY=3\n\n"
+	if err := in.read(strings.NewReader(data), ""); err != io.EOF {
+		t.Fatal(err)
+	}
+	cursor := func() string {
+		e, _ := checkpoint.Get(in.cursorKey())
+		return e.Cursor
+	}
+	if len(msgs) != 2 || cursor() != "" {
+		t.Fatalf("messages:%d, cursor:%q, want 2 messages and no cursor", len(msgs), cursor())
+	}
+	//后面的先发送完,前面的没有发送完时不推进
+	msgs[1].Ack.Done()
+	if cursor() != "" {
+		t.Errorf("cursor = %q before first message delivered", cursor())
+	}
+	msgs[0].Ack.Done()
+	if cursor() != "c3" {
+		t.Errorf("cursor = %q, want c3", cursor())
+	}
+}
+
+func TestMessage(t *testing.T) {
+	in := newTestInput(t, module.CollectConf{Name: "journal", Topic: "journal"})
+	msg := in.message(map[string]string{
+		"__CURSOR":             "c1",
+		"__REALTIME_TIMESTAMP": "1700000000000001",
+		"MESSAGE":              "hello",
+		"PRIORITY":             "3",
+		"_SYSTEMD_UNIT":        "nginx.service",
+		"_BOOT_ID":             "b1",
+	})
+	want := map[string]interface{}{
+		"priority": 3,
+		"severity": "err",
+		"unit":     "nginx.service",
+		"boot_id":  "b1",
+		"message":  "hello",
+	}
+	if msg.Msg != "hello" || msg.Time.UnixNano() != 1700000000000001000 || !reflect.DeepEqual(msg.Fields, want) {
+		t.Errorf("message = %q, time = %v, fields = %v", msg.Msg, msg.Time, msg.Fields)
+	}
+}
+
+func newTestInput(t *testing.T, conf module.CollectConf) *input {
+	in, err := newInput(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
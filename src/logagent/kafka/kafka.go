@@ -1,20 +1,76 @@
 package kafka
 
 import (
+	"errors"
+	"fmt"
 	"github.com/astaxie/beego/logs"
 	"github.com/shopify/sarama"
+	"time"
 )
 var (
-	client sarama.SyncProducer
+	//死信topic等直接发送时使用的生产者
+	producer *Producer
 )
-func InitKafka(addr string) (err error) {
 
+//Producer 一个kafka集群的同步生产者
+type Producer struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+}
+
+//NewProducer 连接addrs中的broker,version为空时使用sarama默认版本
+func NewProducer(addrs []string, version string) (*Producer, error) {
 	config := sarama.NewConfig()
+	if len(version) > 0 {
+		v, err := sarama.ParseKafkaVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka version:%s, err:%v", version, err)
+		}
+		config.Version = v
+	}
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Partitioner = sarama.NewRandomPartitioner
 	config.Producer.Return.Successes = true
 
-	client, err = sarama.NewSyncProducer([]string{addr}, config)
+	client, err := sarama.NewClient(addrs, config)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Producer{client: client, producer: sp}, nil
+}
+
+//SendMessages 发送一批消息,部分失败时返回sarama.ProducerErrors
+func (p *Producer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return p.producer.SendMessages(msgs)
+}
+
+//Health 连接已关闭或者没有可用的broker时返回错误
+func (p *Producer) Health() error {
+	if p.client.Closed() {
+		return errors.New("kafka client closed")
+	}
+	if len(p.client.Brokers()) == 0 {
+		return errors.New("no kafka broker available")
+	}
+	return nil
+}
+
+func (p *Producer) Close() error {
+	err := p.producer.Close()
+	if e := p.client.Close(); err == nil && e != sarama.ErrClosedClient {
+		err = e
+	}
+	return err
+}
+
+func InitKafka(addr, version string) (err error) {
+
+	producer, err = NewProducer([]string{addr}, version)
 	if err != nil {
 		logs.Error("init kafka producer failed, err:", err)
 		return
@@ -23,13 +79,14 @@ func InitKafka(addr string) (err error) {
 	logs.Debug("init kafka succ")
 	return
 }
-func SendToKafka(data, topic string) (err error) {
+func SendToKafka(data, topic string, timestamp time.Time) (err error) {
 
 	msg := &sarama.ProducerMessage{}
 	msg.Topic = topic
 	msg.Value = sarama.StringEncoder(data)
+	msg.Timestamp = timestamp
 
-	pid, offset, err := client.SendMessage(msg)
+	pid, offset, err := producer.producer.SendMessage(msg)
 	if err != nil {
 		logs.Error("send message failed, err:%v data:%v topic:%v", err, data, topic)
 		return
@@ -38,3 +95,33 @@ func SendToKafka(data, topic string) (err error) {
 	logs.Debug("send succ, pid:%v offset:%v, topic:%v\n", pid, offset, topic)
 	return
 }
+
+//IsMessageTooLarge 消息超过kafka允许的大小,重试也不会成功
+func IsMessageTooLarge(err error) bool {
+	return err == sarama.ErrMessageSizeTooLarge || err == sarama.ErrMessageSetSizeTooLarge
+}
+
+//IsRetriable 判断发送失败是否值得重试,消息本身有问题或者没有权限时重试也不会成功
+func IsRetriable(err error) bool {
+	if IsMessageTooLarge(err) {
+		return false
+	}
+	if _, ok := err.(sarama.ConfigurationError); ok {
+		return false
+	}
+	switch err {
+	case sarama.ErrInvalidMessage,
+		sarama.ErrInvalidMessageSize,
+		sarama.ErrInvalidTopic,
+		sarama.ErrInvalidRequiredAcks,
+		sarama.ErrTopicAuthorizationFailed,
+		sarama.ErrClusterAuthorizationFailed,
+		sarama.ErrInvalidTimestamp,
+		sarama.ErrUnsupportedVersion,
+		sarama.ErrUnsupportedForMessageFormat,
+		sarama.ErrPolicyViolation:
+		return false
+	}
+	//网络错误,leader切换,副本不足等都可以重试
+	return true
+}
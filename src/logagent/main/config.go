@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/astaxie/beego/config"
 	"logagent/module"
+	"strconv"
+	"strings"
+	"time"
 )
 var (
 	appConfig *module.Config
@@ -33,11 +36,51 @@ func LoadConf(confType, fileName string) (*module.Config,error) {
 		appConfig.KafkaAddr = "localhost:9092"
 	}
 
+	//消息带时间戳需要kafka 0.10以上
+	appConfig.KafkaVersion = conf.DefaultString("logs::kafka_version", "0.10.2.0")
+
+	appConfig.ServerAddr = fmt.Sprintf("%s:%d",
+		conf.DefaultString("server::listen_ip", "0.0.0.0"), conf.DefaultInt("server::port", 8080))
+
+	appConfig.CheckpointPath = conf.DefaultString("logs::checkpoint_path", "./logs/checkpoint.json")
+
+	appConfig.SendRetries = conf.DefaultInt("logs::send_retries", 5)
+	appConfig.RetryBackoff, err = time.ParseDuration(conf.DefaultString("logs::retry_backoff", "100ms"))
+	if err != nil {
+		fmt.Println("load retry_backoff conf failed,err:",err)
+		return nil,err
+	}
+	appConfig.RetryMaxBackoff, err = time.ParseDuration(conf.DefaultString("logs::retry_max_backoff", "10s"))
+	if err != nil {
+		fmt.Println("load retry_max_backoff conf failed,err:",err)
+		return nil,err
+	}
+
+	appConfig.DeadLetterType = conf.DefaultString("dead_letter::type", "file")
+	appConfig.DeadLetterPath = conf.DefaultString("dead_letter::path", "./logs/dead_letter.log")
+	appConfig.DeadLetterTopic = conf.DefaultString("dead_letter::topic", "logagent_dead_letter")
+	appConfig.DeadLetterMaxSize, err = parseSize(conf.DefaultString("dead_letter::max_size", "100MB"))
+	if err != nil {
+		fmt.Println("load dead_letter max_size conf failed,err:",err)
+		return nil,err
+	}
+
 	appConfig.ChanSize, err = conf.Int("logs::chan_size")
 	if err != nil {
 		fmt.Println("load chan_size conf failed,err:",err)
 		appConfig.ChanSize = 100
 	}
+	//所有缓存中的消息共用的内存上限,0表示不限制
+	appConfig.MemoryLimit, err = parseSize(conf.DefaultString("logs::memory_limit", "256MB"))
+	if err != nil {
+		fmt.Println("load memory_limit conf failed,err:",err)
+		return nil,err
+	}
+	err = LoadOutputConf(conf)
+	if err != nil {
+		fmt.Println("load output conf failed,err:",err)
+		return nil,err
+	}
 	err = LoadCollectConf(conf)
 	if err != nil {
 		fmt.Println("load collect conf failed,err:",err)
@@ -46,21 +89,391 @@ func LoadConf(confType, fileName string) (*module.Config,error) {
 	return appConfig,nil
 }
 
+//parseSize 解析带KB,MB,GB单位的大小
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		n      int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			unit = u.n
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size:%s", s)
+	}
+	return n * unit, nil
+}
+
+//LoadOutputConf 加载logs::output_sections中列出的所有输出,没有配置时使用logs::kafka_addr作为唯一的kafka输出
+func LoadOutputConf(configer config.Configer) error {
+	sections := configer.Strings("logs::output_sections")
+	for _, section := range sections {
+		section = strings.TrimSpace(section)
+		if len(section) == 0 {
+			continue
+		}
+		oc, err := loadOutputSection(configer, section)
+		if err != nil {
+			return err
+		}
+		for _, v := range appConfig.Outputs {
+			if v.Name == oc.Name {
+				return fmt.Errorf("duplicate output name:%s", oc.Name)
+			}
+		}
+		appConfig.Outputs = append(appConfig.Outputs, oc)
+	}
+	if len(appConfig.Outputs) == 0 {
+		//没有名为kafka的section时全部使用默认值
+		oc, err := loadOutputSection(configer, "kafka")
+		if err != nil {
+			return err
+		}
+		appConfig.Outputs = append(appConfig.Outputs, oc)
+	}
+	return nil
+}
+
+func loadOutputSection(configer config.Configer, section string) (module.OutputConf, error) {
+	var oc module.OutputConf
+	key := func(name string) string {
+		return section + "::" + name
+	}
+	oc.Name = configer.DefaultString(key("name"), section)
+	oc.Type = configer.DefaultString(key("type"), "kafka")
+	for _, topic := range configer.Strings(key("topics")) {
+		if topic = strings.TrimSpace(topic); len(topic) > 0 {
+			oc.Topics = append(oc.Topics, topic)
+		}
+	}
+	switch oc.Type {
+	case "kafka":
+		oc.KafkaAddr = configer.DefaultStrings(key("kafka_addr"), []string{appConfig.KafkaAddr})
+		for i := range oc.KafkaAddr {
+			oc.KafkaAddr[i] = strings.TrimSpace(oc.KafkaAddr[i])
+		}
+		oc.KafkaVersion = configer.DefaultString(key("kafka_version"), appConfig.KafkaVersion)
+	case "file":
+		oc.FilePath = configer.String(key("file_path"))
+		if len(oc.FilePath) == 0 {
+			return oc, fmt.Errorf("invalid %s::file_path", section)
+		}
+		oc.FileFormat = configer.DefaultString(key("file_format"), "raw")
+		if oc.FileFormat != "raw" && oc.FileFormat != "json" {
+			return oc, fmt.Errorf("invalid %s::file_format:%s", section, oc.FileFormat)
+		}
+		size, err := parseSize(configer.DefaultString(key("rotate_size"), "100MB"))
+		if err != nil {
+			return oc, fmt.Errorf("invalid %s::rotate_size", section)
+		}
+		oc.RotateSize = size
+		oc.RotateInterval, err = time.ParseDuration(configer.DefaultString(key("rotate_interval"), "0s"))
+		if err != nil || oc.RotateInterval < 0 {
+			return oc, fmt.Errorf("invalid %s::rotate_interval", section)
+		}
+		oc.Compress = configer.DefaultBool(key("compress"), false)
+		oc.MaxFiles = configer.DefaultInt(key("max_files"), 0)
+		oc.MaxAge, err = time.ParseDuration(configer.DefaultString(key("max_age"), "0s"))
+		if err != nil || oc.MaxAge < 0 {
+			return oc, fmt.Errorf("invalid %s::max_age", section)
+		}
+	case "elasticsearch":
+		oc.URL = configer.String(key("url"))
+		if len(oc.URL) == 0 {
+			return oc, fmt.Errorf("invalid %s::url", section)
+		}
+		oc.Index = configer.DefaultString(key("index"), "logagent-%{topic}-%Y.%m.%d")
+		oc.BulkAction = configer.DefaultString(key("bulk_action"), "index")
+		if oc.BulkAction != "index" && oc.BulkAction != "create" {
+			return oc, fmt.Errorf("invalid %s::bulk_action:%s", section, oc.BulkAction)
+		}
+		oc.IndexTemplate = configer.String(key("index_template"))
+		oc.IndexTemplateName = configer.DefaultString(key("index_template_name"), "logagent")
+		if err := loadHTTPOutput(configer, section, &oc); err != nil {
+			return oc, err
+		}
+	case "webhook":
+		oc.URL = configer.String(key("url"))
+		if len(oc.URL) == 0 {
+			return oc, fmt.Errorf("invalid %s::url", section)
+		}
+		oc.Method = strings.ToUpper(configer.DefaultString(key("method"), "POST"))
+		oc.Headers = configer.Strings(key("headers"))
+		oc.WebhookFormat = configer.DefaultString(key("webhook_format"), "json")
+		if oc.WebhookFormat != "json" && oc.WebhookFormat != "ndjson" {
+			return oc, fmt.Errorf("invalid %s::webhook_format:%s", section, oc.WebhookFormat)
+		}
+		oc.BodyTemplate = configer.String(key("body_template"))
+		oc.Gzip = configer.DefaultBool(key("gzip"), false)
+		if err := loadHTTPOutput(configer, section, &oc); err != nil {
+			return oc, err
+		}
+	default:
+		return oc, fmt.Errorf("invalid %s::type:%s", section, oc.Type)
+	}
+
+	oc.BufferSize = configer.DefaultInt(key("buffer_size"), appConfig.ChanSize)
+	oc.BatchSize = configer.DefaultInt(key("batch_size"), 100)
+	if oc.BufferSize < 0 || oc.BatchSize <= 0 {
+		return oc, fmt.Errorf("invalid %s::buffer_size or batch_size", section)
+	}
+	interval, err := time.ParseDuration(configer.DefaultString(key("flush_interval"), "100ms"))
+	if err != nil || interval <= 0 {
+		return oc, fmt.Errorf("invalid %s::flush_interval", section)
+	}
+	oc.FlushInterval = interval
+	oc.Overflow = configer.DefaultString(key("overflow"), "block")
+	if oc.Overflow != "block" && oc.Overflow != "deadletter" {
+		return oc, fmt.Errorf("invalid %s::overflow:%s", section, oc.Overflow)
+	}
+	oc.BlockTimeout, err = time.ParseDuration(configer.DefaultString(key("block_timeout"), "5s"))
+	if err != nil || oc.BlockTimeout <= 0 {
+		return oc, fmt.Errorf("invalid %s::block_timeout", section)
+	}
+
+	//重试配置默认与logs中的相同
+	oc.SendRetries = configer.DefaultInt(key("send_retries"), appConfig.SendRetries)
+	oc.RetryBackoff = appConfig.RetryBackoff
+	if v := configer.String(key("retry_backoff")); len(v) > 0 {
+		if oc.RetryBackoff, err = time.ParseDuration(v); err != nil {
+			return oc, fmt.Errorf("invalid %s::retry_backoff:%s", section, v)
+		}
+	}
+	oc.RetryMaxBackoff = appConfig.RetryMaxBackoff
+	if v := configer.String(key("retry_max_backoff")); len(v) > 0 {
+		if oc.RetryMaxBackoff, err = time.ParseDuration(v); err != nil {
+			return oc, fmt.Errorf("invalid %s::retry_max_backoff:%s", section, v)
+		}
+	}
+	return oc, nil
+}
+
+//loadHTTPOutput 加载http类输出共用的认证,tls和超时配置
+func loadHTTPOutput(configer config.Configer, section string, oc *module.OutputConf) error {
+	key := func(name string) string {
+		return section + "::" + name
+	}
+	oc.Username = configer.String(key("username"))
+	oc.Password = configer.String(key("password"))
+	oc.TLSCA = configer.String(key("tls_ca"))
+	oc.TLSCert = configer.String(key("tls_cert"))
+	oc.TLSKey = configer.String(key("tls_key"))
+	if len(oc.TLSCert) > 0 && len(oc.TLSKey) == 0 {
+		return fmt.Errorf("invalid %s::tls_key", section)
+	}
+	oc.TLSSkipVerify = configer.DefaultBool(key("tls_skip_verify"), false)
+	timeout, err := time.ParseDuration(configer.DefaultString(key("timeout"), "30s"))
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid %s::timeout", section)
+	}
+	oc.Timeout = timeout
+	return nil
+}
+
+//LoadCollectConf 加载logs::collect_sections中列出的所有收集任务,默认只有collect一个
 func LoadCollectConf(configer config.Configer) error {
+	sections := configer.DefaultStrings("logs::collect_sections", []string{"collect"})
+	for _, section := range sections {
+		section = strings.TrimSpace(section)
+		if len(section) == 0 {
+			continue
+		}
+		cc, err := loadCollectSection(configer, section)
+		if err != nil {
+			return err
+		}
+		appConfig.Collect = append(appConfig.Collect,cc)
+	}
+	if len(appConfig.Collect) == 0 {
+		return errors.New("no collect section configured")
+	}
+	return nil
+}
+
+func loadCollectSection(configer config.Configer, section string) (module.CollectConf, error) {
 	var cc module.CollectConf
-	var err error
-	cc.LogPath = configer.String("collect::log_path")
-	if len(cc.LogPath) == 0 {
-		err = errors.New("invalid collect::log_path")
-		return err
+	key := func(name string) string {
+		return section + "::" + name
+	}
+	cc.Input = configer.DefaultString(key("input"), "file")
+	switch cc.Input {
+	case "file":
+		cc.LogPath = configer.String(key("log_path"))
+		if len(cc.LogPath) == 0 {
+			return cc, fmt.Errorf("invalid %s::log_path", section)
+		}
+	case "docker":
+		cc.LogPath = configer.DefaultString(key("log_path"), "/var/lib/docker/containers/*/*-json.log")
+	case "cri":
+		cc.LogPath = configer.DefaultString(key("log_path"), "/var/log/pods/*/*/*.log")
+		cc.PodList = configer.String(key("pod_list"))
+		refresh, err := time.ParseDuration(configer.DefaultString(key("pod_list_refresh"), "30s"))
+		if err != nil || refresh <= 0 {
+			return cc, fmt.Errorf("invalid %s::pod_list_refresh", section)
+		}
+		cc.PodListRefresh = refresh
+		cc.TopicAnnotation = configer.String(key("topic_annotation"))
+	case "exec":
+		cc.Command = configer.String(key("command"))
+		if len(cc.Command) == 0 {
+			return cc, fmt.Errorf("invalid %s::command", section)
+		}
+		interval, err := time.ParseDuration(configer.DefaultString(key("exec_interval"), "0s"))
+		if err != nil || interval < 0 {
+			return cc, fmt.Errorf("invalid %s::exec_interval", section)
+		}
+		cc.ExecInterval = interval
+	case "journal":
+		cc.JournalFile = configer.String(key("journal_file"))
+		cc.JournalCommand = configer.DefaultString(key("journal_command"), "journalctl")
+		cc.JournalUnits = configer.Strings(key("journal_units"))
+		cc.JournalPriority = configer.String(key("journal_priority"))
+	case "syslog":
+		cc.Listen = configer.String(key("listen"))
+		if len(cc.Listen) == 0 {
+			return cc, fmt.Errorf("invalid %s::listen", section)
+		}
+		cc.SyslogFormat = configer.DefaultString(key("syslog_format"), "auto")
+		size, err := parseSize(configer.DefaultString(key("max_message_bytes"), "64KB"))
+		if err != nil || size <= 0 {
+			return cc, fmt.Errorf("invalid %s::max_message_bytes", section)
+		}
+		cc.MaxMessageBytes = int(size)
+	case "socket":
+		cc.Listen = configer.String(key("listen"))
+		if len(cc.Listen) == 0 {
+			return cc, fmt.Errorf("invalid %s::listen", section)
+		}
+	case "http":
+		cc.HTTPPath = configer.DefaultString(key("http_path"), "/ingest/"+section)
+		cc.AllowedTopics = configer.Strings(key("allowed_topics"))
+		size, err := parseSize(configer.DefaultString(key("max_body_size"), "10MB"))
+		if err != nil {
+			return cc, fmt.Errorf("invalid %s::max_body_size", section)
+		}
+		cc.MaxBodySize = size
+		cc.HTTPToken = configer.String(key("http_token"))
+	default:
+		return cc, fmt.Errorf("invalid %s::input:%s", section, cc.Input)
+	}
+
+	cc.Topic = configer.String(key("topic"))
+	if len(cc.Topic) == 0 {
+		return cc, fmt.Errorf("invalid %s::topic", section)
 	}
 
-	cc.Topic = configer.String("collect::topic")
-	if len(cc.LogPath) == 0 {
-		err = errors.New("invalid collect::topic")
-		return err
+	cc.Name = configer.DefaultString(key("name"), cc.Topic)
+	for _, name := range configer.Strings(key("outputs")) {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		found := false
+		for _, v := range appConfig.Outputs {
+			if v.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return cc, fmt.Errorf("invalid %s::outputs:output %s not found", section, name)
+		}
+		cc.Outputs = append(cc.Outputs, name)
 	}
+	cc.TopicRoutes = configer.Strings(key("topic_routes"))
+	cc.ConnRateLines = configer.DefaultInt(key("conn_rate_lines"), 0)
+	cc.ConnRateBytes = configer.DefaultInt(key("conn_rate_bytes"), 0)
+
+	cc.Backfill = configer.DefaultBool(key("backfill"), false)
+	cc.BackfillPattern = configer.DefaultString(key("backfill_pattern"), cc.LogPath+".*")
+
+	cc.StartPosition = configer.DefaultString(key("start_position"), "beginning")
+	switch cc.StartPosition {
+	case "beginning", "end", "bytes", "lines":
+	default:
+		return cc, fmt.Errorf("invalid %s::start_position:%s", section, cc.StartPosition)
+	}
+	cc.StartLast = configer.DefaultInt64(key("start_last"), 0)
+	if ignoreOlder := configer.String(key("ignore_older")); len(ignoreOlder) > 0 {
+		d, err := time.ParseDuration(ignoreOlder)
+		if err != nil {
+			return cc, fmt.Errorf("invalid %s::ignore_older:%s", section, ignoreOlder)
+		}
+		cc.IgnoreOlder = d
+	}
+
+	cc.WatchMode = configer.DefaultString(key("watch_mode"), "inotify")
+	if cc.WatchMode != "inotify" && cc.WatchMode != "poll" {
+		return cc, fmt.Errorf("invalid %s::watch_mode:%s", section, cc.WatchMode)
+	}
+	interval, err := time.ParseDuration(configer.DefaultString(key("poll_interval"), "250ms"))
+	if err != nil || interval <= 0 {
+		return cc, fmt.Errorf("invalid %s::poll_interval", section)
+	}
+	cc.PollInterval = interval
+
+	//队列配置,priority高的任务优先发送,同一优先级内按weight分配
+	cc.QueueSize = configer.DefaultInt(key("queue_size"), appConfig.ChanSize)
+	cc.Weight = configer.DefaultInt(key("weight"), 1)
+	cc.Priority = configer.DefaultString(key("priority"), "normal")
+
+	cc.Encoding = configer.String(key("encoding"))
+	cc.EncodingInvalid = configer.DefaultString(key("encoding_invalid"), "replace")
+
+	cc.MaxLineBytes = configer.DefaultInt(key("max_line_bytes"), 0)
+	cc.MaxLineMode = configer.DefaultString(key("max_line_mode"), "truncate")
+	cc.TruncateField = configer.DefaultString(key("truncate_field"), "truncated")
+
+	cc.Decoder = configer.String(key("decoder"))
+	cc.DecodeFlatten = configer.DefaultBool(key("decode_flatten"), false)
+	cc.DecodeSep = configer.DefaultString(key("decode_flatten_sep"), ".")
+	cc.DecodeKeepRaw = configer.DefaultBool(key("decode_keep_raw"), false)
+	cc.DecodeRawField = configer.DefaultString(key("decode_raw_field"), "message")
+	cc.DecodeOnError = configer.DefaultString(key("decode_on_error"), "pass")
+
+	cc.TimestampField = configer.String(key("timestamp_field"))
+	cc.TimestampRegex = configer.String(key("timestamp_regex"))
+	cc.TimestampLayouts = configer.Strings(key("timestamp_layouts"))
+	cc.TimestampTimezone = configer.String(key("timestamp_timezone"))
+	cc.TimestampTarget = configer.DefaultString(key("timestamp_target"), "@timestamp")
+
+	cc.Include = configer.Strings(key("include"))
+	cc.Exclude = configer.Strings(key("exclude"))
+	cc.MinLevel = configer.String(key("min_level"))
+	//为空时按输入类型选择默认字段
+	cc.LevelField = configer.String(key("level_field"))
+
+	cc.Redact = configer.Strings(key("redact"))
+	cc.RedactPatterns = configer.Strings(key("redact_patterns"))
+	cc.RedactStrategy = configer.DefaultString(key("redact_strategy"), "mask")
+	cc.RedactKeepLast = configer.DefaultInt(key("redact_keep_last"), 4)
+	cc.RedactSalt = configer.String(key("redact_salt"))
+
+	cc.Dedup = configer.DefaultBool(key("dedup"), false)
+	cc.DedupWindow = configer.DefaultString(key("dedup_window"), "5s")
+	cc.DedupNormalize = configer.DefaultBool(key("dedup_normalize"), false)
+	cc.DedupMaxKeys = configer.DefaultInt(key("dedup_max_keys"), 10000)
+
+	if v := configer.String(key("sample_rate")); len(v) > 0 {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return cc, fmt.Errorf("invalid %s::sample_rate:%s", section, v)
+		}
+		cc.SampleRate = &rate
+	}
+	cc.SampleMode = configer.DefaultString(key("sample_mode"), "random")
+	cc.SampleKey = configer.String(key("sample_key"))
+	cc.SampleRules = configer.Strings(key("sample_rules"))
+
+	cc.RateLines = configer.DefaultInt(key("rate_lines"), 0)
+	cc.RateBytes = configer.DefaultInt(key("rate_bytes"), 0)
+	cc.RateMode = configer.DefaultString(key("rate_mode"), "block")
 
-	appConfig.Collect = append(appConfig.Collect,cc)
-	return err
+	return cc, nil
 }
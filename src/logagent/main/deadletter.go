@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"logagent/kafka"
+	"logagent/metrics"
+	"logagent/module"
+	"os"
+	"sync"
+	"time"
+)
+
+//deadLetterSink 保存无法投递的消息
+type deadLetterSink interface {
+	Write(record []byte) error
+}
+
+//fileSink 追加写到本地文件,一条记录一行,超过maxSize时轮转
+type fileSink struct {
+	lk      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+func newFileSink(path string, maxSize int64) (*fileSink, error) {
+	s := &fileSink{path: path, maxSize: maxSize}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+//rotate 当前文件改名为path.1,覆盖上一次轮转的文件
+func (s *fileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		logs.Error("rotate dead letter file failed,err:%v", err)
+	}
+	return s.open()
+}
+
+func (s *fileSink) Write(record []byte) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	line := append(record, '\n')
+	var err error
+	switch {
+	case s.file == nil:
+		//上次轮转后没有打开成功
+		err = s.open()
+	case s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize:
+		err = s.rotate()
+	}
+	if err != nil {
+		return err
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+//topicSink 写到单独的kafka topic
+type topicSink struct {
+	topic string
+}
+
+func (s *topicSink) Write(record []byte) error {
+	return kafka.SendToKafka(string(record), s.topic, time.Time{})
+}
+
+var (
+	deadLetters deadLetterSink
+)
+
+func initDeadLetter() error {
+	switch appConfig.DeadLetterType {
+	case "file":
+		sink, err := newFileSink(appConfig.DeadLetterPath, appConfig.DeadLetterMaxSize)
+		if err != nil {
+			return err
+		}
+		deadLetters = sink
+	case "kafka":
+		//死信topic使用logs::kafka_addr,与输出的kafka分开连接
+		if err := kafka.InitKafka(appConfig.KafkaAddr, appConfig.KafkaVersion); err != nil {
+			return err
+		}
+		deadLetters = &topicSink{topic: appConfig.DeadLetterTopic}
+	case "none", "":
+	default:
+		return fmt.Errorf("invalid dead_letter::type:%s", appConfig.DeadLetterType)
+	}
+	return nil
+}
+
+//deadLetterRecord 死信记录,保留原始消息和失败原因
+type deadLetterRecord struct {
+	Time      string `json:"time"`
+	Topic     string `json:"topic"`
+	Output    string `json:"output,omitempty"`
+	Source    string `json:"source,omitempty"`
+	EventTime string `json:"event_time,omitempty"`
+	Error     string `json:"error"`
+	Retriable bool   `json:"retriable"`
+	Attempts  int    `json:"attempts"`
+	Value     string `json:"value"`
+}
+
+func deadLetter(msg *module.TextMsg, output string, reason error, attempts int, retriable bool) {
+	metrics.Inc("dead_letter.total", 1)
+	logs.Error("send to %s failed,move to dead letter,topic:%s,attempts:%d,err:%v", output, msg.Topic, attempts, reason)
+	if deadLetters == nil {
+		return
+	}
+
+	record := &deadLetterRecord{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Topic:     msg.Topic,
+		Output:    output,
+		Source:    msg.Source,
+		Error:     reason.Error(),
+		Retriable: retriable,
+		Attempts:  attempts,
+		Value:     msg.Value(),
+	}
+	if !msg.Time.IsZero() {
+		record.EventTime = msg.Time.Format(time.RFC3339Nano)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		logs.Error("marshal dead letter failed,err:%v", err)
+		return
+	}
+	err = deadLetters.Write(data)
+	if err != nil {
+		metrics.Inc("dead_letter.write_errors", 1)
+		logs.Error("write dead letter failed,err:%v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"logagent/module"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//recordSink 记录写入的死信
+type recordSink struct {
+	records [][]byte
+}
+
+func (s *recordSink) Write(record []byte) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logagent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestDeadLetterRecord(t *testing.T) {
+	sink := &recordSink{}
+	old := deadLetters
+	deadLetters = sink
+	defer func() { deadLetters = old }()
+
+	eventTime := time.Date(2024, 3, 5, 1, 2, 3, 0, time.UTC)
+	tests := []struct {
+		name string
+		msg  *module.TextMsg
+		want deadLetterRecord
+	}{
+		{
+			"plain text",
+			&module.TextMsg{Msg: "hello", Topic: "app"},
+			deadLetterRecord{Topic: "app", Output: "kafka", Error: "rejected", Retriable: false, Attempts: 1, Value: "hello"},
+		},
+		{
+			"fields and metadata",
+			&module.TextMsg{Msg: "x", Topic: "nginx", Source: "/var/log/nginx.log", Time: eventTime,
+				Fields: map[string]interface{}{"message": "x", "status": 500}},
+			deadLetterRecord{Topic: "nginx", Output: "kafka", Source: "/var/log/nginx.log",
+				EventTime: "2024-03-05T01:02:03Z", Error: "rejected", Retriable: false, Attempts: 1,
+				Value: `{"message":"x","status":500}`},
+		},
+	}
+	for i, tt := range tests {
+		deadLetter(tt.msg, "kafka", errors.New("rejected"), 1, false)
+		if len(sink.records) != i+1 {
+			t.Fatalf("%s: got %d records", tt.name, len(sink.records))
+		}
+		var got deadLetterRecord
+		if err := json.Unmarshal(sink.records[i], &got); err != nil {
+			t.Fatalf("%s: invalid record %s:%v", tt.name, sink.records[i], err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, got.Time); err != nil {
+			t.Errorf("%s: invalid time %q", tt.name, got.Time)
+		}
+		got.Time = ""
+		if got != tt.want {
+			t.Errorf("%s: record = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	//重试耗尽的消息标记为可重试
+	deadLetter(&module.TextMsg{Msg: "y", Topic: "app"}, "es", errors.New("timeout"), 5, true)
+	var record map[string]interface{}
+	json.Unmarshal(sink.records[len(sink.records)-1], &record)
+	if record["retriable"] != true || record["attempts"] != float64(5) || record["error"] != "timeout" || record["output"] != "es" {
+		t.Errorf("record = %v", record)
+	}
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	path := filepath.Join(tempDir(t), "dead_letter.log")
+	//已有的内容计入大小
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := newFileSink(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{"aaaa", "bbbb", "cccc", "dddddddddddd"} {
+		if err := sink.Write([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	//超长的记录单独写一个文件,只保留最近一个轮转文件
+	if got := read(path); got != "dddddddddddd\n" {
+		t.Errorf("current file = %q", got)
+	}
+	if got := read(path + ".1"); got != "bbbb\ncccc\n" {
+		t.Errorf("rotated file = %q", got)
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 1 {
+		t.Errorf("rotated files = %v", matches)
+	}
+
+	//max_size为0时不轮转
+	path = filepath.Join(tempDir(t), "unbounded.log")
+	sink, err = newFileSink(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		sink.Write([]byte(strings.Repeat("x", 20)))
+	}
+	if n := strings.Count(read(path), "\n"); n != 3 {
+		t.Errorf("got %d lines, want 3", n)
+	}
+}
+
+func TestInitDeadLetter(t *testing.T) {
+	oldConf, oldSink := appConfig, deadLetters
+	defer func() { appConfig, deadLetters = oldConf, oldSink }()
+
+	path := filepath.Join(tempDir(t), "dead_letter.log")
+	tests := []struct {
+		typ     string
+		wantErr bool
+		file    bool
+	}{
+		{"file", false, true},
+		{"none", false, false},
+		{"redis", true, false},
+	}
+	for _, tt := range tests {
+		deadLetters = nil
+		appConfig = &module.Config{DeadLetterType: tt.typ, DeadLetterPath: path}
+		err := initDeadLetter()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("type %s: err = %v", tt.typ, err)
+		}
+		if _, ok := deadLetters.(*fileSink); ok != tt.file {
+			t.Errorf("type %s: sink = %T", tt.typ, deadLetters)
+		}
+	}
+}
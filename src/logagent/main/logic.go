@@ -1,27 +1,14 @@
 package main
 
 import (
-	"github.com/astaxie/beego/logs"
-	"logagent/kafka"
-	"logagent/tailf"
-	"time"
+	"logagent/output"
+	"logagent/queue"
 )
 
 func serverRun() error {
 
 	for{
-		msg := tailf.GetOneLine()
-		err := SendTokafka(msg)
-		if err != nil {
-			logs.Error("send to kafka failed,err:%v",err)
-			time.Sleep(time.Second)
-			continue
-		}
+		//按任务的outputs配置分发,每个输出自己负责批量发送和重试
+		output.Dispatch(queue.Get())
 	}
-	return nil
-}
-
-func SendTokafka(msg *tailf.TextMsg) error {
-	//logs.Debug("read msg:%s,topic:%s",msg.Msg,msg.Topic)
-	return kafka.SendToKafka(msg.Msg,msg.Topic)
 }
@@ -3,48 +3,93 @@ package main
 import (
 	"fmt"
 	"github.com/astaxie/beego/logs"
-	"logagent/kafka"
+	"logagent/checkpoint"
+	"logagent/command"
+	"logagent/ingest"
+	"logagent/journal"
+	"logagent/memory"
+	"logagent/output"
+	"logagent/syslog"
 	"logagent/tailf"
 	"os"
+	"time"
 )
 
 func main() {
+	//logagent pipe -topic x 从标准输入读取
+	if len(os.Args) > 1 && os.Args[1] == "pipe" {
+		os.Exit(runPipe(os.Args[2:]))
+	}
 	//加载配置
 	sysdir, err := os.Getwd()
 	if err != nil {
 		fmt.Printf("get sys path failed,err:%v\n",err)
 		panic("get sys path failed")
-		return
 	}
 	filename := sysdir+"/conf/logagent.conf"
 	appConfig, err := LoadConf("ini", filename)
 	if err != nil {
 		fmt.Printf("load conf failed,err:%v\n",err)
 		panic("load conf failed")
-		return
 	}
 	//初始化日志
 	err = initLogger()
 	if err != nil {
 		fmt.Printf("load logger failed, err:%v\n", err)
 		panic("load logger failed")
-		return
 	}
 	logs.Debug("init succ")
 	logs.Debug("log conf succ,config:%v",appConfig)
 
+	memory.SetLimit(appConfig.MemoryLimit)
+	err = checkpoint.Init(appConfig.CheckpointPath, 5*time.Second)
+	if err != nil {
+		logs.Error("init checkpoint failed,err:%v",err)
+		return
+	}
 	err = tailf.InitTail(appConfig)
 	if err != nil {
 		logs.Error("init tail failed,err:%v",err)
 		return
 	}
 	logs.Debug("init tailf succ")
-	err = kafka.InitKafka(appConfig.KafkaAddr)
+	err = syslog.InitSyslog(appConfig)
+	if err != nil {
+		logs.Error("init syslog failed,err:%v",err)
+		return
+	}
+	err = command.InitCommand(appConfig)
+	if err != nil {
+		logs.Error("init command failed,err:%v",err)
+		return
+	}
+	err = journal.InitJournal(appConfig)
+	if err != nil {
+		logs.Error("init journal failed,err:%v",err)
+		return
+	}
+	err = ingest.InitIngest(appConfig)
+	if err != nil {
+		logs.Error("init ingest failed,err:%v",err)
+		return
+	}
+	err = initDeadLetter()
+	if err != nil {
+		logs.Error("init dead letter failed,err:%v",err)
+		return
+	}
+	err = output.Init(appConfig, deadLetter)
+	if err != nil {
+		logs.Error("init output failed,err:%v",err)
+		return
+	}
+	logs.Debug("init output succ")
+	err = initServer()
 	if err != nil {
-		logs.Error("init kafka failed,err:%v",err)
+		logs.Error("init server failed,err:%v",err)
 		return
 	}
-	logs.Debug("init kafka succ")
+	logs.Debug("init server succ")
 	err = serverRun()
 	if err != nil {
 		logs.Error("serverRun failed,err:%v",err)
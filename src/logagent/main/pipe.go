@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"logagent/memory"
+	"logagent/module"
+	"logagent/output"
+	"logagent/process"
+	"logagent/queue"
+	"os"
+	"strings"
+	"time"
+)
+
+//runPipe 把标准输入的每一行经过处理链发送到配置的输出,输入结束并且全部发送完后退出,
+//有消息写入死信时返回1
+func runPipe(args []string) int {
+	fs := flag.NewFlagSet("pipe", flag.ExitOnError)
+	topic := fs.String("topic", "", "kafka topic")
+	confFile := fs.String("conf", "./conf/logagent.conf", "config file")
+	task := fs.String("task", "", "use processing options of the collect task with this name")
+	fs.Parse(args)
+	if len(*topic) == 0 {
+		fmt.Fprintln(os.Stderr, "logagent pipe: -topic is required")
+		fs.Usage()
+		return 2
+	}
+
+	_, err := LoadConf("ini", *confFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load conf failed,err:%v\n", err)
+		return 1
+	}
+	if err = initLogger(); err != nil {
+		fmt.Fprintf(os.Stderr, "init logger failed,err:%v\n", err)
+		return 1
+	}
+	//标准输出可能还要接其他命令,日志只写文件
+	logs.GetBeeLogger().DelLogger(logs.AdapterConsole)
+
+	conf, err := pipeConf(*topic, *task)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	memory.SetLimit(appConfig.MemoryLimit)
+	q, err := queue.Register(conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "register queue failed,err:%v\n", err)
+		return 1
+	}
+	chain, err := process.New(conf, q.Put)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "init process chain failed,err:%v\n", err)
+		return 1
+	}
+	if err = initDeadLetter(); err != nil {
+		fmt.Fprintf(os.Stderr, "init dead letter failed,err:%v\n", err)
+		return 1
+	}
+	//只有这一个任务,按它的outputs配置发送
+	appConfig.Collect = []module.CollectConf{conf}
+	if err = output.Init(appConfig, deadLetter); err != nil {
+		fmt.Fprintf(os.Stderr, "init output failed,err:%v\n", err)
+		return 1
+	}
+	go serverRun()
+	return pipe(os.Stdin, chain, conf.Topic, os.Stderr)
+}
+
+//pipe 把r的每一行经过处理链发送,读完并且全部发送完后关闭输出,有消息没有送达时返回1
+func pipe(r io.Reader, chain *process.Chain, topic string, stderr io.Writer) int {
+	reader := bufio.NewReader(r)
+	lines := 0
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) > 0 {
+			chain.Process(&module.TextMsg{Msg: line, Topic: topic, Source: "stdin"})
+			lines++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "read stdin failed,err:%v\n", err)
+			break
+		}
+	}
+
+	//发出合并重复行等缓存的消息,然后等待全部发送完
+	chain.Close()
+	for queue.Pending() > 0 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	memory.Close()
+	output.Close()
+	if failed := output.Failed(); failed > 0 {
+		fmt.Fprintf(stderr, "logagent pipe: %d of %d lines not delivered, see dead letter\n", failed, lines)
+		return 1
+	}
+	return 0
+}
+
+//pipeConf 标准输入任务的配置,指定task时使用该任务的处理配置
+func pipeConf(topic, task string) (module.CollectConf, error) {
+	conf := module.CollectConf{
+		Name:      "pipe",
+		QueueSize: appConfig.ChanSize,
+	}
+	if len(task) > 0 {
+		found := false
+		for _, v := range appConfig.Collect {
+			if v.Name == task {
+				conf = v
+				found = true
+				break
+			}
+		}
+		if !found {
+			return conf, fmt.Errorf("logagent pipe: collect task %s not found", task)
+		}
+	}
+	conf.Input = "pipe"
+	conf.Topic = topic
+	return conf, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"logagent/module"
+	"logagent/output"
+	"logagent/process"
+	"logagent/queue"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//slowOutput 发送较慢,包含fail的消息永久失败
+type slowOutput struct {
+	lk   sync.Mutex
+	sent []string
+}
+
+func (o *slowOutput) Send(msgs []*module.TextMsg) error {
+	time.Sleep(20 * time.Millisecond)
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	errs := make([]error, len(msgs))
+	failed := false
+	for i, msg := range msgs {
+		if strings.Contains(msg.Msg, "fail") {
+			errs[i] = output.Permanent(errors.New("rejected"))
+			failed = true
+			continue
+		}
+		o.sent = append(o.sent, msg.Msg)
+	}
+	if failed {
+		return &output.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+func (o *slowOutput) Flush() error  { return nil }
+func (o *slowOutput) Close() error  { return nil }
+func (o *slowOutput) Health() error { return nil }
+
+//TestPipe 读完输入后等待所有消息发送完才返回,有消息没有送达时返回1
+func TestPipe(t *testing.T) {
+	out := &slowOutput{}
+	output.Register("pipe_test", func(conf module.OutputConf) (output.Output, error) {
+		return out, nil
+	})
+	conf := module.CollectConf{Name: "pipe", Input: "pipe", Topic: "t", QueueSize: 10}
+	config := &module.Config{
+		Outputs: []module.OutputConf{{Name: "pipe_test", Type: "pipe_test", BufferSize: 10, BatchSize: 2, FlushInterval: 10 * time.Millisecond}},
+		Collect: []module.CollectConf{conf},
+	}
+	var dead []string
+	if err := output.Init(config, func(msg *module.TextMsg, name string, reason error, attempts int, retriable bool) {
+		dead = append(dead, msg.Msg)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	q, err := queue.Register(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := process.New(conf, q.Put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serverRun()
+
+	var stderr bytes.Buffer
+	code := pipe(strings.NewReader("a\r\nb\n\nfail\nc\nd\ne"), chain, "t", &stderr)
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if queue.Pending() != 0 {
+		t.Errorf("returned with %d messages pending", queue.Pending())
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(out.sent, want) {
+		t.Errorf("sent = %q, want %q", out.sent, want)
+	}
+	if !reflect.DeepEqual(dead, []string{"fail"}) {
+		t.Errorf("dead letter = %q, want [fail]", dead)
+	}
+	if !strings.Contains(stderr.String(), "1 of 6 lines not delivered") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestRunPipeTopicRequired(t *testing.T) {
+	if code := runPipe(nil); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/astaxie/beego/logs"
+	"logagent/ingest"
+	"logagent/metrics"
+	"logagent/output"
+	"logagent/tailf"
+	"net"
+	"net/http"
+)
+
+//initServer 启动管理接口,提供运行指标和采集状态查询,以及http收集任务的接收地址
+func initServer() error {
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/status", statusHandler)
+	for path, h := range ingest.Handlers() {
+		http.Handle(path, h)
+	}
+
+	ln, err := net.Listen("tcp", appConfig.ServerAddr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := http.Serve(ln, nil)
+		if err != nil {
+			logs.Error("admin server exited,err:%v", err)
+		}
+	}()
+	logs.Debug("admin server listen on %s", appConfig.ServerAddr)
+	return nil
+}
+
+//statusHandler 返回各采集任务和输出的状态
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{
+		"files":   tailf.Status(),
+		"outputs": output.Status(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logs.Warn("write status failed,err:%v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"logagent/metrics"
+	"sync"
+)
+
+//budget 所有缓存中消息占用的字节数,超出上限时申请方阻塞
+type budget struct {
+	lk     sync.Mutex
+	cond   *sync.Cond
+	used   int64
+	limit  int64
+	closed bool
+}
+
+var (
+	mem = newBudget()
+)
+
+func init() {
+	metrics.GaugeFunc("memory.used_bytes", mem.usedBytes)
+	metrics.GaugeFunc("memory.limit_bytes", func() int64 {
+		mem.lk.Lock()
+		defer mem.lk.Unlock()
+		return mem.limit
+	})
+}
+
+func newBudget() *budget {
+	b := &budget{}
+	b.cond = sync.NewCond(&b.lk)
+	return b
+}
+
+func (b *budget) usedBytes() int64 {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.used
+}
+
+func (b *budget) setLimit(limit int64) {
+	b.lk.Lock()
+	b.limit = limit
+	b.lk.Unlock()
+	b.cond.Broadcast()
+}
+
+//full 再申请n字节是否超出上限,没有消息占用时总是放行,避免单条超大消息永远等不到
+func (b *budget) full(n int64) bool {
+	return !b.closed && b.limit > 0 && b.used > 0 && b.used+n > b.limit
+}
+
+func (b *budget) acquire(n int64) {
+	b.lk.Lock()
+	if b.full(n) {
+		metrics.Inc("memory.blocked", 1)
+		for b.full(n) {
+			b.cond.Wait()
+		}
+	}
+	b.used += n
+	b.lk.Unlock()
+}
+
+func (b *budget) tryAcquire(n int64) bool {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.full(n) {
+		metrics.Inc("memory.rejected", 1)
+		return false
+	}
+	b.used += n
+	return true
+}
+
+func (b *budget) release(n int64) {
+	b.lk.Lock()
+	b.used -= n
+	b.lk.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *budget) close() {
+	b.lk.Lock()
+	b.closed = true
+	b.lk.Unlock()
+	b.cond.Broadcast()
+}
+
+//SetLimit 设置内存上限,0表示不限制
+func SetLimit(limit int64) {
+	mem.setLimit(limit)
+}
+
+//Acquire 申请n字节,超出上限时阻塞直到其他消息释放
+func Acquire(n int64) {
+	mem.acquire(n)
+}
+
+//TryAcquire 申请n字节,超出上限时不等待,返回false
+//用于持有锁的调用方,避免阻塞在其他协程释放内存之前
+func TryAcquire(n int64) bool {
+	return mem.tryAcquire(n)
+}
+
+//Release 释放Acquire申请的字节
+func Release(n int64) {
+	mem.release(n)
+}
+
+//Close 退出时唤醒所有等待的申请方,之后的申请不再阻塞
+func Close() {
+	mem.close()
+}
+
+//Used 当前占用的字节数
+func Used() int64 {
+	return mem.usedBytes()
+}
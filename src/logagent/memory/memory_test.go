@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"testing"
+	"time"
+)
+
+//acquired 在协程中申请,返回申请成功时关闭的channel
+func acquired(b *budget, n int64) chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		b.acquire(n)
+		close(ch)
+	}()
+	return ch
+}
+
+func waitFor(t *testing.T, ch chan struct{}, want bool) {
+	t.Helper()
+	select {
+	case <-ch:
+		if !want {
+			t.Fatal("acquire should block")
+		}
+	case <-time.After(50 * time.Millisecond):
+		if want {
+			t.Fatal("acquire still blocked")
+		}
+	}
+}
+
+func TestAcquireBlock(t *testing.T) {
+	b := newBudget()
+	b.setLimit(100)
+	b.acquire(80)
+	ch := acquired(b, 30)
+	waitFor(t, ch, false)
+	//释放到不超过上限时放行
+	b.release(10)
+	waitFor(t, ch, true)
+	if used := b.usedBytes(); used != 100 {
+		t.Errorf("used = %d, want 100", used)
+	}
+}
+
+func TestAcquireOversize(t *testing.T) {
+	b := newBudget()
+	b.setLimit(100)
+	//没有其他占用时超大的消息也放行
+	waitFor(t, acquired(b, 1000), true)
+	ch := acquired(b, 1)
+	waitFor(t, ch, false)
+	b.release(1000)
+	waitFor(t, ch, true)
+
+	//调大上限也会唤醒等待的申请
+	ch = acquired(b, 200)
+	waitFor(t, ch, false)
+	b.setLimit(0)
+	waitFor(t, ch, true)
+}
+
+func TestTryAcquire(t *testing.T) {
+	b := newBudget()
+	b.setLimit(100)
+	if !b.tryAcquire(150) {
+		t.Error("first acquire should succeed when nothing is used")
+	}
+	if b.tryAcquire(1) {
+		t.Error("acquire over the limit should fail")
+	}
+	b.release(150)
+	if !b.tryAcquire(100) || b.usedBytes() != 100 {
+		t.Errorf("used = %d, want 100", b.usedBytes())
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := newBudget()
+	b.setLimit(10)
+	b.acquire(10)
+	waiters := []chan struct{}{acquired(b, 5), acquired(b, 5)}
+	for _, ch := range waiters {
+		waitFor(t, ch, false)
+	}
+	b.close()
+	for _, ch := range waiters {
+		waitFor(t, ch, true)
+	}
+	//关闭后不再阻塞
+	waitFor(t, acquired(b, 100), true)
+	if !b.tryAcquire(100) {
+		t.Error("tryAcquire should succeed after close")
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+var (
+	registry = gometrics.NewRegistry()
+)
+
+//Counter 获取或注册一个计数器
+func Counter(name string) gometrics.Counter {
+	return gometrics.GetOrRegisterCounter(name, registry)
+}
+
+//Gauge 获取或注册一个瞬时值
+func Gauge(name string) gometrics.Gauge {
+	return gometrics.GetOrRegisterGauge(name, registry)
+}
+
+//GaugeFunc 注册一个读取时才计算的瞬时值
+func GaugeFunc(name string, f func() int64) {
+	registry.Unregister(name)
+	registry.Register(name, gometrics.NewFunctionalGauge(f))
+}
+
+//Inc 计数器加上delta
+func Inc(name string, delta int64) {
+	Counter(name).Inc(delta)
+}
+
+//Handler 以json格式输出所有指标
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		gometrics.WriteJSONOnce(registry, w)
+	})
+}
@@ -0,0 +1,28 @@
+package module
+
+import (
+	"sync/atomic"
+)
+
+//Ack 一行日志产生的消息都处理完后调用done,一行可能被拆成多条消息,也可能被过滤掉
+type Ack struct {
+	pending int32
+	done    func()
+}
+
+//NewAck 创建时持有一个引用,读取方处理完这一行后调用Done释放
+func NewAck(done func()) *Ack {
+	return &Ack{pending: 1, done: done}
+}
+
+//Add 增加一条待处理的消息
+func (a *Ack) Add() {
+	atomic.AddInt32(&a.pending, 1)
+}
+
+//Done 一条消息处理完,全部处理完时调用done
+func (a *Ack) Done() {
+	if atomic.AddInt32(&a.pending, -1) == 0 {
+		a.done()
+	}
+}
@@ -1,17 +1,213 @@
 package module
 
+import (
+	"time"
+)
+
 //config 存取加载的配置
 type Config struct {
 	LogLevel  string        `json:"log_level"`
 	LogPath   string        `json:"log_path"`
 	ChanSize  int           `json:"chan_size"`
+	MemoryLimit int64       `json:"memory_limit"`
+	CheckpointPath string   `json:"checkpoint_path"`
 	KafkaAddr string        `json:"kafka_addr"`
+	KafkaVersion string     `json:"kafka_version"`
+	ServerAddr string       `json:"server_addr"`
+
+	//发送失败的重试次数和退避时间
+	SendRetries     int           `json:"send_retries"`
+	RetryBackoff    time.Duration `json:"retry_backoff"`
+	RetryMaxBackoff time.Duration `json:"retry_max_backoff"`
+
+	//死信配置,dead_letter_type为file,kafka或none
+	DeadLetterType    string `json:"dead_letter_type"`
+	DeadLetterPath    string `json:"dead_letter_path"`
+	DeadLetterTopic   string `json:"dead_letter_topic"`
+	//死信文件超过这个大小时轮转,0表示不轮转
+	DeadLetterMaxSize int64  `json:"dead_letter_max_size"`
 	Collect   []CollectConf `json:"collect"`
+	Outputs   []OutputConf  `json:"outputs"`
+}
+
+//OutputConf 输出配置,每个输出有自己的缓冲区和重试
+type OutputConf struct {
+	Name string `json:"name"`
+	//输出类型,kafka,file,elasticsearch或webhook
+	Type string `json:"type"`
+	//只发送这些topic的消息,为空时不限制,可以配合topic_routes把部分消息路由到这个输出
+	Topics []string `json:"topics"`
+
+	//缓冲区大小,每批最多发送batch_size条,不足时最多等待flush_interval
+	BufferSize    int           `json:"buffer_size"`
+	BatchSize     int           `json:"batch_size"`
+	FlushInterval time.Duration `json:"flush_interval"`
+	//缓冲区满时的处理,block最多等待block_timeout,deadletter直接写入死信
+	Overflow     string        `json:"overflow"`
+	BlockTimeout time.Duration `json:"block_timeout"`
+
+	//发送失败的重试次数和退避时间
+	SendRetries     int           `json:"send_retries"`
+	RetryBackoff    time.Duration `json:"retry_backoff"`
+	RetryMaxBackoff time.Duration `json:"retry_max_backoff"`
+
+	//kafka输出的broker地址和版本
+	KafkaAddr    []string `json:"kafka_addr"`
+	KafkaVersion string   `json:"kafka_version"`
+
+	//file输出的路径和格式,file_format为raw或json
+	FilePath   string `json:"file_path"`
+	FileFormat string `json:"file_format"`
+	//超过rotate_size或者打开超过rotate_interval后轮转,0表示不按该条件轮转
+	RotateSize     int64         `json:"rotate_size"`
+	RotateInterval time.Duration `json:"rotate_interval"`
+	//轮转后的文件是否gzip压缩,保留的文件数和时间,0表示不限制
+	Compress bool          `json:"compress"`
+	MaxFiles int           `json:"max_files"`
+	MaxAge   time.Duration `json:"max_age"`
+
+	//http类输出的地址,basic认证,tls和请求超时
+	URL           string        `json:"url"`
+	Username      string        `json:"username"`
+	Password      string        `json:"password"`
+	TLSCA         string        `json:"tls_ca"`
+	TLSCert       string        `json:"tls_cert"`
+	TLSKey        string        `json:"tls_key"`
+	TLSSkipVerify bool          `json:"tls_skip_verify"`
+	Timeout       time.Duration `json:"timeout"`
+
+	//elasticsearch的索引名称模板,bulk_action为index或create
+	Index      string `json:"index"`
+	BulkAction string `json:"bulk_action"`
+	//第一次发送前通过PUT _index_template/<index_template_name>上传的索引模板文件
+	IndexTemplate     string `json:"index_template"`
+	IndexTemplateName string `json:"index_template_name"`
+
+	//webhook的请求方法和附加的请求头,每个为Name: value
+	Method  string   `json:"method"`
+	Headers []string `json:"headers"`
+	//请求体格式,json为数组,ndjson每行一个,body_template不为空时每条消息按模板生成
+	WebhookFormat string `json:"webhook_format"`
+	BodyTemplate  string `json:"body_template"`
+	Gzip          bool   `json:"gzip"`
 }
 //CollectConf 日志收集配置
 type CollectConf struct {
+	Name 		string `json:"name"`
 	LogPath 	string `json:"log_path"`
 	Topic 		string `json:"topic"`
-}
+	//发送到哪些输出,为空时发送到所有输出
+	Outputs []string `json:"outputs"`
+
+	//输入类型,file跟踪日志文件,docker和cri按log_path通配符跟踪容器日志,
+	//exec按行读取命令输出,journal读取systemd journal,syslog监听listen地址接收syslog消息,socket按行接收tcp/udp数据,
+	//http通过管理接口的http_path接收POST
+	Input        string `json:"input"`
+	Listen       string `json:"listen"`
+	SyslogFormat string `json:"syslog_format"`
+	//syslog单条消息的最大字节数,tcp连接上超过时断开
+	MaxMessageBytes int    `json:"max_message_bytes"`
+	HTTPPath        string `json:"http_path"`
+	//http请求可以用topic参数指定allowed_topics中的topic
+	AllowedTopics []string `json:"allowed_topics"`
+	MaxBodySize   int64    `json:"max_body_size"`
+	//http请求需要带Authorization: Bearer <http_token>,为空时不校验
+	HTTPToken string `json:"http_token"`
+	//每个连接或客户端的限速,0表示不限制
+	ConnRateLines int `json:"conn_rate_lines"`
+	ConnRateBytes int `json:"conn_rate_bytes"`
+
+	//启动时先补采匹配backfill_pattern的轮转文件,支持.gz,.zst,.lz4
+	Backfill        bool   `json:"backfill"`
+	BackfillPattern string `json:"backfill_pattern"`
 
+	//没有checkpoint时开始读取的位置,start_position为beginning,end,bytes或lines,
+	//bytes和lines从最后start_last个字节或行开始;超过ignore_older没有修改的文件跳过已有内容
+	StartPosition string        `json:"start_position"`
+	StartLast     int64         `json:"start_last"`
+	IgnoreOlder   time.Duration `json:"ignore_older"`
+
+	//文件变化的监听方式,watch_mode为inotify或poll,inotify收不到事件时自动改为poll
+	WatchMode    string        `json:"watch_mode"`
+	PollInterval time.Duration `json:"poll_interval"`
+
+	//任务队列配置
+	QueueSize int    `json:"queue_size"`
+	Weight    int    `json:"weight"`
+	Priority  string `json:"priority"`
+
+	//exec任务运行的命令,exec_interval为0时作为常驻进程运行,退出后重新启动
+	Command      string        `json:"command"`
+	ExecInterval time.Duration `json:"exec_interval"`
+
+	//journal任务读取journal_file保存的export文件,为空时运行journal_command -o export -f,
+	//journal_units和journal_priority过滤unit和级别
+	JournalFile     string   `json:"journal_file"`
+	JournalCommand  string   `json:"journal_command"`
+	JournalUnits    []string `json:"journal_units"`
+	JournalPriority string   `json:"journal_priority"`
+
+	//cri任务的pod信息来源,可以是json文件或者返回pod列表的http地址
+	PodList        string        `json:"pod_list"`
+	PodListRefresh time.Duration `json:"pod_list_refresh"`
+	//pod有这个annotation时发送到annotation的值对应的topic
+	TopicAnnotation string `json:"topic_annotation"`
+	//按字段路由到不同的topic,格式为field=regex:topic
+	TopicRoutes []string `json:"topic_routes"`
+
+	//文件编码,读取后先转成utf-8,encoding_invalid为replace或drop
+	Encoding        string `json:"encoding"`
+	EncodingInvalid string `json:"encoding_invalid"`
+
+	//超长行处理,max_line_mode为truncate,split或drop
+	MaxLineBytes  int    `json:"max_line_bytes"`
+	MaxLineMode   string `json:"max_line_mode"`
+	TruncateField string `json:"truncate_field"`
+
+	//解码配置,decoder为json或logfmt,为空时按原始文本发送
+	Decoder        string `json:"decoder"`
+	DecodeFlatten  bool   `json:"decode_flatten"`
+	DecodeSep      string `json:"decode_flatten_sep"`
+	DecodeKeepRaw  bool   `json:"decode_keep_raw"`
+	DecodeRawField string `json:"decode_raw_field"`
+	DecodeOnError  string `json:"decode_on_error"`
+
+	//事件时间提取配置,从字段或正则中取值,按layouts依次尝试解析
+	TimestampField    string   `json:"timestamp_field"`
+	TimestampRegex    string   `json:"timestamp_regex"`
+	TimestampLayouts  []string `json:"timestamp_layouts"`
+	TimestampTimezone string   `json:"timestamp_timezone"`
+	TimestampTarget   string   `json:"timestamp_target"`
+
+	//过滤配置,include和exclude匹配原始行,min_level作用于解析出的级别字段
+	Include    []string `json:"include"`
+	Exclude    []string `json:"exclude"`
+	MinLevel   string   `json:"min_level"`
+	LevelField string   `json:"level_field"`
+
+	//脱敏配置,redact为内置规则列表,redact_patterns为自定义正则
+	Redact         []string `json:"redact"`
+	RedactPatterns []string `json:"redact_patterns"`
+	RedactStrategy string   `json:"redact_strategy"`
+	RedactKeepLast int      `json:"redact_keep_last"`
+	RedactSalt     string   `json:"redact_salt"`
+
+	//重复行合并配置,窗口内相同的行合并成一条并带上重复次数
+	Dedup          bool   `json:"dedup"`
+	DedupWindow    string `json:"dedup_window"`
+	DedupNormalize bool   `json:"dedup_normalize"`
+	DedupMaxKeys   int    `json:"dedup_max_keys"`
+
+	//采样配置,sample_rules按顺序匹配,都不匹配时使用sample_rate
+	//sample_rate为nil表示没有配置,全部保留,配置为0时全部丢弃
+	SampleRate  *float64 `json:"sample_rate"`
+	SampleMode  string   `json:"sample_mode"`
+	SampleKey   string   `json:"sample_key"`
+	SampleRules []string `json:"sample_rules"`
+
+	//限速配置,每秒行数和字节数,0表示不限制
+	RateLines int    `json:"rate_lines"`
+	RateBytes int    `json:"rate_bytes"`
+	RateMode  string `json:"rate_mode"`
+}
 
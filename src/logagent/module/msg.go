@@ -0,0 +1,96 @@
+package module
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//TextMsg 一条待发送的日志消息
+type TextMsg struct {
+	Msg    string
+	Topic  string
+	//消息来源,比如日志文件路径
+	Source string
+	Fields map[string]interface{}
+	//事件发生的时间,为空时由kafka使用发送时间
+	Time time.Time
+	//所属的收集任务,放入队列时设置
+	Task string
+	//读取进度的确认,放入队列时Add,处理完时Done,为空表示不需要确认
+	Ack *Ack
+}
+
+//SetField 设置一个字段,原始文本消息会先放到message字段中
+func (m *TextMsg) SetField(key string, value interface{}) {
+	if m.Fields == nil {
+		m.Fields = map[string]interface{}{"message": m.Msg}
+	}
+	m.Fields[key] = value
+}
+
+//SetMsg 修改原始文本,已经有message字段时一起修改
+func (m *TextMsg) SetMsg(text string) {
+	m.Msg = text
+	if _, ok := m.Fields["message"]; ok {
+		m.Fields["message"] = text
+	}
+}
+
+//Size 估算消息占用的内存,解码出的数字,嵌套的map和数组也计算在内
+func (m *TextMsg) Size() int64 {
+	size := len(m.Msg) + len(m.Topic) + len(m.Source)
+	for k, v := range m.Fields {
+		size += len(k) + valueSize(v)
+	}
+	return int64(size)
+}
+
+//valueSize 估算一个字段值占用的字节数,按元素递归累加
+func valueSize(v interface{}) int {
+	const overhead = 16
+	switch v := v.(type) {
+	case string:
+		return overhead + len(v)
+	case json.Number:
+		return overhead + len(v)
+	case []byte:
+		return overhead + len(v)
+	case map[string]interface{}:
+		size := overhead
+		for k, e := range v {
+			size += len(k) + valueSize(e)
+		}
+		return size
+	case map[string]string:
+		size := overhead
+		for k, e := range v {
+			size += len(k) + overhead + len(e)
+		}
+		return size
+	case []interface{}:
+		size := overhead
+		for _, e := range v {
+			size += valueSize(e)
+		}
+		return size
+	case []string:
+		size := overhead
+		for _, e := range v {
+			size += overhead + len(e)
+		}
+		return size
+	}
+	return overhead
+}
+
+//Value 返回发送到kafka的内容,没有解析出字段时原样发送
+func (m *TextMsg) Value() string {
+	if len(m.Fields) == 0 {
+		return m.Msg
+	}
+	data, err := json.Marshal(m.Fields)
+	if err != nil {
+		return m.Msg
+	}
+	return string(data)
+}
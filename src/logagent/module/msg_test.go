@@ -0,0 +1,44 @@
+package module
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   int64
+	}{
+		{"text only", nil, 5},
+		{"string", map[string]interface{}{"k": "abc"}, 5 + 1 + 16 + 3},
+		{"number", map[string]interface{}{"n": json.Number("12345"), "f": 1.5}, 5 + 1 + 16 + 5 + 1 + 16},
+		{
+			"nested",
+			map[string]interface{}{"m": map[string]interface{}{"a": "xyz", "l": []interface{}{"p", 1}}},
+			5 + 1 + 16 + (1 + 16 + 3) + (1 + 16 + (16 + 1) + 16),
+		},
+		{
+			"labels",
+			map[string]interface{}{"labels": map[string]string{"app": "web"}, "tags": []string{"a", "bc"}},
+			5 + 6 + 16 + (3 + 16 + 3) + 4 + 16 + (16 + 1) + (16 + 2),
+		},
+	}
+	for _, tt := range tests {
+		msg := &TextMsg{Msg: "hello", Fields: tt.fields}
+		if got := msg.Size(); got != tt.want {
+			t.Errorf("%s: Size = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	//大的嵌套字段按内容计算
+	big := make([]interface{}, 1000)
+	for i := range big {
+		big[i] = "0123456789"
+	}
+	msg := &TextMsg{Fields: map[string]interface{}{"list": big}}
+	if size := msg.Size(); size < 10000 {
+		t.Errorf("Size of 1000 nested strings = %d", size)
+	}
+}
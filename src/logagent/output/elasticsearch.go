@@ -0,0 +1,200 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"io/ioutil"
+	"logagent/module"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	Register("elasticsearch", newESOutput)
+}
+
+//esOutput 通过_bulk接口写入elasticsearch,索引名称按模板生成
+type esOutput struct {
+	conf   module.OutputConf
+	base   string
+	url    string
+	index  *template
+	client *http.Client
+	//还没有上传的索引模板,上传成功或者被拒绝后置为nil
+	indexTemplate []byte
+}
+
+//bulkResponse _bulk的返回,items与请求中的文档一一对应
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func newESOutput(conf module.OutputConf) (Output, error) {
+	index, err := newTemplate(conf.Index)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	e := &esOutput{
+		conf:   conf,
+		base:   strings.TrimRight(conf.URL, "/"),
+		index:  index,
+		client: client,
+	}
+	e.url = e.base + "/_bulk"
+	if len(conf.IndexTemplate) > 0 {
+		data, err := ioutil.ReadFile(conf.IndexTemplate)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("invalid index_template %s,not json", conf.IndexTemplate)
+		}
+		e.indexTemplate = data
+	}
+	return e, nil
+}
+
+func (e *esOutput) Send(msgs []*module.TextMsg) error {
+	if e.indexTemplate != nil {
+		//上传失败时这一批也不发送,避免用默认mapping创建索引
+		if err := e.putTemplate(); err != nil {
+			if !IsPermanent(err) {
+				return err
+			}
+			logs.Error("index template rejected,send without it,output:%s,err:%v", e.conf.Name, err)
+		}
+		e.indexTemplate = nil
+	}
+	errs := make([]error, len(msgs))
+	//编码失败的消息不发送,sent记录请求中每个文档对应的消息
+	var sent []int
+	var body bytes.Buffer
+	for i, msg := range msgs {
+		doc, err := document(msg)
+		if err != nil {
+			errs[i] = Permanent(err)
+			continue
+		}
+		action, _ := json.Marshal(map[string]map[string]string{
+			e.conf.BulkAction: {"_index": strings.ToLower(e.index.render(msg))},
+		})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+		sent = append(sent, i)
+	}
+	if len(sent) > 0 {
+		if err := e.bulk(&body, sent, errs); err != nil {
+			if len(sent) == len(msgs) {
+				return err
+			}
+			for _, i := range sent {
+				errs[i] = err
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+//bulk 发送一次请求,按返回的items设置每条消息的结果,整个请求失败时返回错误
+func (e *esOutput) bulk(body io.Reader, sent []int, errs []error) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, body)
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	setAuth(req, e.conf)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, data, e.conf.RetryMaxBackoff)
+	}
+
+	var result bulkResponse
+	if err = json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("decode bulk response failed,err:%v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	//不知道哪些文档已经写入,重试会重复写入,直接写入死信
+	if len(result.Items) != len(sent) {
+		return Permanent(fmt.Errorf("bulk response has %d items,expect %d", len(result.Items), len(sent)))
+	}
+	for i, item := range result.Items {
+		for _, r := range item {
+			if r.Status >= 200 && r.Status < 300 {
+				continue
+			}
+			err := fmt.Errorf("bulk item failed,status:%d,error:%s", r.Status, r.Error)
+			if !retriableStatus(r.Status) {
+				err = Permanent(err)
+			}
+			errs[sent[i]] = err
+		}
+	}
+	return nil
+}
+
+//putTemplate 上传索引模板
+func (e *esOutput) putTemplate() error {
+	req, err := http.NewRequest(http.MethodPut, e.base+"/_index_template/"+e.conf.IndexTemplateName,
+		bytes.NewReader(e.indexTemplate))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuth(req, e.conf)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError(resp, data, e.conf.RetryMaxBackoff)
+	}
+	logs.Info("index template uploaded,output:%s,name:%s", e.conf.Name, e.conf.IndexTemplateName)
+	return nil
+}
+
+//Flush 每批同步发送,没有内部缓存
+func (e *esOutput) Flush() error {
+	return nil
+}
+
+func (e *esOutput) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+//Health 发送结果由Sink记录,这里不额外检查
+func (e *esOutput) Health() error {
+	return nil
+}
@@ -0,0 +1,280 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"logagent/module"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeES 记录收到的请求,bulk按respond返回每个文档的状态
+type fakeES struct {
+	lk        sync.Mutex
+	bulks     [][]bulkDoc
+	templates []string
+	//返回的模板上传状态码,为0时返回200
+	templateStatus int
+	//按收到的文档返回状态码,为空时全部返回201
+	respond func(req int, docs []bulkDoc) []int
+}
+
+type bulkDoc struct {
+	index   string
+	message string
+}
+
+func (f *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/") {
+		body, _ := ioutil.ReadAll(r.Body)
+		f.templates = append(f.templates, r.URL.Path+" "+string(body))
+		if f.templateStatus != 0 {
+			w.WriteHeader(f.templateStatus)
+			return
+		}
+		w.Write([]byte(`{"acknowledged":true}`))
+		return
+	}
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var docs []bulkDoc
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		json.Unmarshal(scanner.Bytes(), &action)
+		scanner.Scan()
+		var doc map[string]interface{}
+		json.Unmarshal(scanner.Bytes(), &doc)
+		message, _ := doc["message"].(string)
+		docs = append(docs, bulkDoc{index: action["index"]["_index"], message: message})
+	}
+	f.bulks = append(f.bulks, docs)
+
+	statuses := make([]int, len(docs))
+	for i := range statuses {
+		statuses[i] = http.StatusCreated
+	}
+	if f.respond != nil {
+		statuses = f.respond(len(f.bulks), docs)
+	}
+	resp := bulkResponse{}
+	for _, status := range statuses {
+		item := bulkItemResult{Status: status}
+		if status >= 300 {
+			resp.Errors = true
+			item.Error = json.RawMessage(fmt.Sprintf(`{"type":"status_%d"}`, status))
+		}
+		resp.Items = append(resp.Items, map[string]bulkItemResult{"index": item})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeES) requests() [][]bulkDoc {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return append([][]bulkDoc(nil), f.bulks...)
+}
+
+func newTestES(t *testing.T, es *fakeES, conf module.OutputConf) Output {
+	srv := httptest.NewServer(es)
+	t.Cleanup(srv.Close)
+	conf.Name = "es"
+	conf.URL = srv.URL
+	if len(conf.Index) == 0 {
+		conf.Index = "logagent-%{topic}-%Y.%m.%d"
+	}
+	conf.BulkAction = "index"
+	if len(conf.IndexTemplateName) == 0 {
+		conf.IndexTemplateName = "logagent"
+	}
+	out, err := newESOutput(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestESItemErrors(t *testing.T) {
+	es := &fakeES{respond: func(req int, docs []bulkDoc) []int {
+		return []int{http.StatusCreated, http.StatusTooManyRequests, http.StatusBadRequest, http.StatusServiceUnavailable}
+	}}
+	out := newTestES(t, es, module.OutputConf{})
+	err := out.Send([]*module.TextMsg{{Msg: "ok"}, {Msg: "throttled"}, {Msg: "mapping"}, {Msg: "unavailable"}})
+	berr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("Send err = %v, want *BatchError", err)
+	}
+	tests := []struct {
+		name      string
+		failed    bool
+		permanent bool
+	}{
+		{"201", false, false},
+		{"429", true, false},
+		{"400", true, true},
+		{"503", true, false},
+	}
+	for i, tt := range tests {
+		e := berr.Errors[i]
+		if (e != nil) != tt.failed || IsPermanent(e) != tt.permanent {
+			t.Errorf("item %s: err = %v, want failed %v permanent %v", tt.name, e, tt.failed, tt.permanent)
+		}
+	}
+}
+
+//TestESRetryFailedItems 通过Sink发送时只重试429的文档,400的文档写入死信
+func TestESRetryFailedItems(t *testing.T) {
+	dl := captureDeadLetters(t)
+	es := &fakeES{respond: func(req int, docs []bulkDoc) []int {
+		statuses := make([]int, len(docs))
+		for i, doc := range docs {
+			switch {
+			case doc.message == "throttled" && req == 1:
+				statuses[i] = http.StatusTooManyRequests
+			case doc.message == "mapping":
+				statuses[i] = http.StatusBadRequest
+			default:
+				statuses[i] = http.StatusCreated
+			}
+		}
+		return statuses
+	}}
+	s := testSink(module.OutputConf{BufferSize: 10, SendRetries: 3}, newTestES(t, es, module.OutputConf{}))
+	for _, text := range []string{"ok", "throttled", "mapping"} {
+		s.put(&delivery{msg: &module.TextMsg{Msg: text, Topic: "app"}, remaining: 1})
+	}
+	s.stop()
+
+	reqs := es.requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d bulk requests, want 2", len(reqs))
+	}
+	if len(reqs[0]) != 3 || len(reqs[1]) != 1 || reqs[1][0].message != "throttled" {
+		t.Errorf("bulk requests = %v, want all three then only the throttled one", reqs)
+	}
+	if _, ok := dl.msgs["mapping"]; !ok || dl.count() != 1 {
+		t.Errorf("dead letters = %v, want only the 400 document", dl.msgs)
+	}
+}
+
+//TestESItemsMismatch items数量不对时不知道哪些已经写入,不能重试
+func TestESItemsMismatch(t *testing.T) {
+	es := &fakeES{respond: func(req int, docs []bulkDoc) []int {
+		return []int{http.StatusTooManyRequests}
+	}}
+	out := newTestES(t, es, module.OutputConf{})
+	err := out.Send([]*module.TextMsg{{Msg: "a"}, {Msg: "b"}})
+	if err == nil || !IsPermanent(err) {
+		t.Errorf("Send err = %v, want permanent error", err)
+	}
+}
+
+func TestESRequestStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+		after     time.Duration
+	}{
+		{http.StatusTooManyRequests, false, 2 * time.Second},
+		{http.StatusBadGateway, false, 0},
+		{http.StatusUnauthorized, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.after > 0 {
+					w.Header().Set("Retry-After", fmt.Sprint(int(tt.after.Seconds())))
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			out, err := newESOutput(module.OutputConf{Name: "es", URL: srv.URL, Index: "logs", BulkAction: "index"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = out.Send([]*module.TextMsg{{Msg: "a"}})
+			if err == nil || IsPermanent(err) != tt.permanent || retryDelay(err) != tt.after {
+				t.Errorf("Send err = %v, permanent %v, retry after %v", err, IsPermanent(err), retryDelay(err))
+			}
+		})
+	}
+}
+
+func TestESIndexTemplate(t *testing.T) {
+	path := filepath.Join(tempDir(t), "template.json")
+	body := `{"index_patterns":["logagent-*"]}`
+	if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//上传失败时不发送,下一批重新上传
+	es := &fakeES{templateStatus: http.StatusServiceUnavailable}
+	out := newTestES(t, es, module.OutputConf{IndexTemplate: path, IndexTemplateName: "logs"})
+	if err := out.Send([]*module.TextMsg{{Msg: "a"}}); err == nil || IsPermanent(err) {
+		t.Fatalf("Send err = %v, want retriable error", err)
+	}
+	if len(es.requests()) != 0 {
+		t.Fatal("bulk sent before index template was uploaded")
+	}
+
+	es.lk.Lock()
+	es.templateStatus = 0
+	es.lk.Unlock()
+	for i := 0; i < 2; i++ {
+		if err := out.Send([]*module.TextMsg{{Msg: "a"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"/_index_template/logs " + body, "/_index_template/logs " + body}
+	if len(es.templates) != len(want) || es.templates[0] != want[0] || es.templates[1] != want[1] {
+		t.Errorf("template requests = %q, want %q", es.templates, want)
+	}
+	if len(es.requests()) != 2 {
+		t.Errorf("got %d bulk requests, want 2", len(es.requests()))
+	}
+
+	//模板文件不是json时创建失败
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newESOutput(module.OutputConf{URL: "http://127.0.0.1:1", Index: "logs", IndexTemplate: path}); err == nil {
+		t.Error("expect error for invalid index template")
+	}
+}
+
+func TestESIndexName(t *testing.T) {
+	es := &fakeES{}
+	out := newTestES(t, es, module.OutputConf{Index: "logs-%{topic}-%{service}-%Y.%m.%d"})
+	local := time.FixedZone("UTC+8", 8*3600)
+	msgs := []*module.TextMsg{
+		//按UTC计算日期
+		{Msg: "a", Topic: "Nginx", Time: time.Date(2024, 3, 6, 7, 30, 0, 0, local),
+			Fields: map[string]interface{}{"message": "a", "service": "API"}},
+		{Msg: "b", Topic: "app", Time: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC)},
+	}
+	if err := out.Send(msgs); err != nil {
+		t.Fatal(err)
+	}
+	reqs := es.requests()
+	want := []string{"logs-nginx-api-2024.03.05", "logs-app--2023.12.31"}
+	if len(reqs) != 1 || len(reqs[0]) != len(want) {
+		t.Fatalf("bulk requests = %v", reqs)
+	}
+	for i, w := range want {
+		if reqs[0][i].index != w {
+			t.Errorf("doc %d index = %s, want %s", i, reqs[0][i].index, w)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package output
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"logagent/metrics"
+	"logagent/module"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("file", newFileOutput)
+}
+
+//fileRecord format为json时每行的内容
+type fileRecord struct {
+	Time      string                 `json:"time"`
+	EventTime string                 `json:"event_time,omitempty"`
+	Topic     string                 `json:"topic"`
+	Task      string                 `json:"task,omitempty"`
+	Source    string                 `json:"source,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+//fileOutput 写到本地文件,按大小和时间轮转,轮转后的文件可以压缩并按数量和时间清理
+type fileOutput struct {
+	conf   module.OutputConf
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	opened time.Time
+
+	lk  sync.Mutex
+	err error
+	//压缩和清理在后台进行,同时只做一个
+	wg      sync.WaitGroup
+	cleanLk sync.Mutex
+}
+
+func newFileOutput(conf module.OutputConf) (Output, error) {
+	f := &fileOutput{conf: conf}
+	if err := os.MkdirAll(filepath.Dir(conf.FilePath), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fileOutput) open() error {
+	file, err := os.OpenFile(f.conf.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.writer = bufio.NewWriterSize(file, 64*1024)
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+func (f *fileOutput) Send(msgs []*module.TextMsg) error {
+	if f.file == nil {
+		//上次轮转或者写入失败,重新打开
+		if err := f.open(); err != nil {
+			f.setError(err)
+			return err
+		}
+	}
+	errs := make([]error, len(msgs))
+	failed := false
+	//flushed之前的消息已经写入文件
+	flushed := 0
+	var err error
+	for i, msg := range msgs {
+		line, e := f.format(msg)
+		if e != nil {
+			//只有这条消息有问题,其他消息照常写入
+			errs[i] = Permanent(e)
+			failed = true
+			continue
+		}
+		if f.needRotate(len(line)) {
+			if err = f.rotate(); err != nil {
+				break
+			}
+			flushed = i
+		}
+		if _, err = f.writer.Write(line); err != nil {
+			break
+		}
+		f.size += int64(len(line))
+	}
+	//写入文件后才算发送成功,缓冲只用来把一批合并成一次写入
+	if err == nil {
+		err = f.writer.Flush()
+	}
+	if err != nil {
+		//已经写入文件的不再重试,只重试剩下的
+		f.setError(err)
+		for j := flushed; j < len(msgs); j++ {
+			if errs[j] == nil {
+				errs[j] = err
+			}
+		}
+		f.reset()
+		return &BatchError{Errors: errs}
+	}
+	f.setError(nil)
+	if failed {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+
+func (f *fileOutput) format(msg *module.TextMsg) ([]byte, error) {
+	if f.conf.FileFormat != "json" {
+		return []byte(msg.Value() + "\n"), nil
+	}
+	record := &fileRecord{
+		Time:   time.Now().Format(time.RFC3339Nano),
+		Topic:  msg.Topic,
+		Task:   msg.Task,
+		Source: msg.Source,
+		Fields: msg.Fields,
+	}
+	if len(msg.Fields) == 0 {
+		record.Message = msg.Msg
+	}
+	if !msg.Time.IsZero() {
+		record.EventTime = msg.Time.Format(time.RFC3339Nano)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+//needRotate 写入n个字节后超过rotate_size,或者打开时间超过rotate_interval时需要轮转,空文件不轮转
+func (f *fileOutput) needRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.conf.RotateSize > 0 && f.size+int64(n) > f.conf.RotateSize {
+		return true
+	}
+	return f.conf.RotateInterval > 0 && time.Since(f.opened) >= f.conf.RotateInterval
+}
+
+//rotate 把当前文件改名为path.时间,再打开新文件
+func (f *fileOutput) rotate() error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	name := f.conf.FilePath + "." + time.Now().Format("20060102-150405")
+	rotated := name
+	for i := 1; exists(rotated) || exists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%d", name, i)
+	}
+	if err := os.Rename(f.conf.FilePath, rotated); err != nil {
+		return err
+	}
+	metrics.Inc("output."+f.conf.Name+".rotations", 1)
+	logs.Info("output file rotated,output:%s,file:%s", f.conf.Name, rotated)
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanLk.Lock()
+		defer f.cleanLk.Unlock()
+		if f.conf.Compress {
+			if err := compressFile(rotated); err != nil {
+				logs.Warn("compress rotated file failed,file:%s,err:%v", rotated, err)
+			}
+		}
+		f.cleanup()
+	}()
+	return f.open()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+//compressFile 压缩成path.gz后删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if e := gz.Close(); err == nil {
+		err = e
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+//cleanup 只保留最新的max_files个轮转文件,删除超过max_age的轮转文件
+func (f *fileOutput) cleanup() {
+	if f.conf.MaxFiles <= 0 && f.conf.MaxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(f.conf.FilePath + ".*")
+	if err != nil {
+		return
+	}
+	type rotatedFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []rotatedFile
+	for _, path := range matches {
+		//轮转的文件名为path.20060102-150405
+		suffix := path[len(f.conf.FilePath)+1:]
+		if len(suffix) == 0 || suffix[0] < '0' || suffix[0] > '9' {
+			continue
+		}
+		//压缩中的文件等压缩完再处理
+		if f.conf.Compress && !strings.HasSuffix(path, ".gz") && exists(path+".gz") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, rotatedFile{path: path, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	for i, file := range files {
+		if (f.conf.MaxFiles > 0 && i >= f.conf.MaxFiles) ||
+			(f.conf.MaxAge > 0 && time.Since(file.modTime) > f.conf.MaxAge) {
+			if err := os.Remove(file.path); err != nil {
+				logs.Warn("remove rotated file failed,file:%s,err:%v", file.path, err)
+				continue
+			}
+			logs.Info("rotated file removed,output:%s,file:%s", f.conf.Name, file.path)
+		}
+	}
+}
+
+//reset 写入失败后关闭文件,bufio出错后不能继续使用,下次发送时重新打开
+func (f *fileOutput) reset() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+func (f *fileOutput) Flush() error {
+	if f.file == nil {
+		return nil
+	}
+	if err := f.writer.Flush(); err != nil {
+		f.setError(err)
+		return err
+	}
+	return nil
+}
+
+func (f *fileOutput) Close() error {
+	err := f.Flush()
+	if f.file != nil {
+		if e := f.file.Close(); err == nil {
+			err = e
+		}
+		f.file = nil
+	}
+	f.wg.Wait()
+	return err
+}
+
+func (f *fileOutput) setError(err error) {
+	f.lk.Lock()
+	f.err = err
+	f.lk.Unlock()
+}
+
+//Health 最近一次写入失败时返回该错误
+func (f *fileOutput) Health() error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.err
+}
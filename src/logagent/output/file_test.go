@@ -0,0 +1,133 @@
+package output
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"logagent/module"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+//TestFileOutputSend Send返回成功时内容已经写入文件,不需要等Flush
+func TestFileOutputSend(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		msgs   []*module.TextMsg
+		want   []string
+	}{
+		{
+			"text", "",
+			[]*module.TextMsg{{Msg: "plain"}, {Msg: "x", Fields: map[string]interface{}{"a": 1}}},
+			[]string{"plain", `{"a":1}`},
+		},
+		{
+			"json", "json",
+			[]*module.TextMsg{{Msg: "plain", Topic: "t", Source: "/var/log/app.log"}},
+			[]string{`"message":"plain"`, `"topic":"t"`, `"source":"/var/log/app.log"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir(t), "out.log")
+			out, err := newFileOutput(module.OutputConf{Name: "file", FilePath: path, FileFormat: tt.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer out.Close()
+			if err := out.Send(tt.msgs); err != nil {
+				t.Fatal(err)
+			}
+			content := readFile(t, path)
+			if n := strings.Count(content, "\n"); n != len(tt.msgs) {
+				t.Errorf("file has %d lines, want %d:\n%s", n, len(tt.msgs), content)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(content, w) {
+					t.Errorf("file content missing %s:\n%s", w, content)
+				}
+			}
+		})
+	}
+}
+
+func TestFileOutputPermanentError(t *testing.T) {
+	path := filepath.Join(tempDir(t), "out.log")
+	out, err := newFileOutput(module.OutputConf{Name: "file", FilePath: path, FileFormat: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	//无法编码成json的消息不影响同一批的其他消息
+	err = out.Send([]*module.TextMsg{
+		{Msg: "ok"},
+		{Msg: "bad", Fields: map[string]interface{}{"ch": make(chan int)}},
+	})
+	berr, ok := err.(*BatchError)
+	if !ok || berr.Errors[0] != nil || !IsPermanent(berr.Errors[1]) {
+		t.Fatalf("Send err = %v, want permanent error for the second message", err)
+	}
+	var record fileRecord
+	if err := json.Unmarshal([]byte(readFile(t, path)), &record); err != nil || record.Message != "ok" {
+		t.Errorf("file content = %q, err %v", readFile(t, path), err)
+	}
+}
+
+func TestFileOutputRotate(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "out.log")
+	out, err := newFileOutput(module.OutputConf{
+		Name:       "file",
+		FilePath:   path,
+		RotateSize: 10,
+		Compress:   true,
+		MaxFiles:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := out.Send([]*module.TextMsg{{Msg: "0123456789"}}); err != nil {
+			t.Fatal(err)
+		}
+		//轮转后的文件名精确到秒,同一秒内会加序号
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readFile(t, path); content != "0123456789\n" {
+		t.Errorf("current file = %q", content)
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v, want 2", rotated)
+	}
+	for _, name := range rotated {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("rotated file %s not compressed", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package output
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"logagent/module"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//newHTTPClient 按tls和超时配置创建http输出使用的client
+func newHTTPClient(conf module.OutputConf) (*http.Client, error) {
+	tlsConf := &tls.Config{InsecureSkipVerify: conf.TLSSkipVerify}
+	if len(conf.TLSCA) > 0 {
+		data, err := ioutil.ReadFile(conf.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificate found in " + conf.TLSCA)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if len(conf.TLSCert) > 0 {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConf
+	return &http.Client{Transport: transport, Timeout: conf.Timeout}, nil
+}
+
+//setAuth 配置了username时使用basic认证
+func setAuth(req *http.Request, conf module.OutputConf) {
+	if len(conf.Username) > 0 {
+		req.SetBasicAuth(conf.Username, conf.Password)
+	}
+}
+
+//statusError 请求失败时的错误,429和5xx带上Retry-After指定的等待时间,最多等待maxWait,其他4xx不可重试
+func statusError(resp *http.Response, body []byte, maxWait time.Duration) error {
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	err := fmt.Errorf("request failed,status:%s,body:%s", resp.Status, body)
+	if !retriableStatus(resp.StatusCode) {
+		return Permanent(err)
+	}
+	return RetryAfter(err, parseRetryAfter(resp.Header.Get("Retry-After"), maxWait))
+}
+
+//parseRetryAfter 支持秒数和http日期两种格式,超过max时按max,max不大于0时不限制
+func parseRetryAfter(v string, max time.Duration) time.Duration {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return 0
+	}
+	var d time.Duration
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n <= 0 {
+			return 0
+		}
+		//避免乘以time.Second时溢出
+		if n > int64(math.MaxInt64/time.Second) {
+			n = int64(math.MaxInt64 / time.Second)
+		}
+		d = time.Duration(n) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
+
+//document 有字段时发送全部字段,否则放在message中,没有@timestamp时使用事件时间或者当前时间
+func document(msg *module.TextMsg) ([]byte, error) {
+	doc := make(map[string]interface{}, len(msg.Fields)+2)
+	for k, v := range msg.Fields {
+		doc[k] = v
+	}
+	if len(msg.Fields) == 0 {
+		doc["message"] = msg.Msg
+	}
+	if _, ok := doc["@timestamp"]; !ok {
+		t := msg.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		doc["@timestamp"] = t.Format(time.RFC3339Nano)
+	}
+	return json.Marshal(doc)
+}
+
+//retriableStatus 超时,限流和服务端错误可以重试,其他4xx重试也不会成功
+func retriableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,91 @@
+package output
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"logagent/module"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		max   time.Duration
+		want  time.Duration
+	}{
+		{"empty", "", time.Minute, 0},
+		{"seconds", "3", time.Minute, 3 * time.Second},
+		{"clamped", "3600", 10 * time.Second, 10 * time.Second},
+		{"no max", "3600", 0, time.Hour},
+		{"overflow", "99999999999999999", time.Minute, time.Minute},
+		{"zero", "0", time.Minute, 0},
+		{"negative", "-5", time.Minute, 0},
+		{"past date", "Mon, 02 Jan 2006 15:04:05 GMT", time.Minute, 0},
+		{"far date", time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat), time.Minute, time.Minute},
+		{"invalid", "soon", time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value, tt.max)
+			if got < 0 {
+				got = 0
+			}
+			if got != tt.want {
+				t.Errorf("parseRetryAfter(%q, %v) = %v, want %v", tt.value, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+//TestHTTPClientTLS 用tls_ca信任测试服务的证书,并带上basic认证
+func TestHTTPClientTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	ca := filepath.Join(tempDir(t), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		conf module.OutputConf
+		ok   bool
+	}{
+		{"trusted ca", module.OutputConf{TLSCA: ca, Username: "elastic", Password: "secret"}, true},
+		{"skip verify", module.OutputConf{TLSSkipVerify: true, Username: "elastic", Password: "secret"}, true},
+		{"unknown ca", module.OutputConf{Username: "elastic", Password: "secret"}, false},
+		{"wrong password", module.OutputConf{TLSCA: ca, Username: "elastic", Password: "x"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Name = "webhook"
+			conf.Type = "webhook"
+			conf.URL = srv.URL
+			conf.Method = http.MethodPost
+			out, err := newWebhookOutput(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer out.Close()
+			err = out.Send([]*module.TextMsg{{Msg: "a"}})
+			if (err == nil) != tt.ok {
+				t.Errorf("Send err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+
+	if _, err := newHTTPClient(module.OutputConf{TLSCA: filepath.Join(filepath.Dir(ca), "missing.pem")}); err == nil {
+		t.Error("expect error for missing tls_ca")
+	}
+}
@@ -0,0 +1,72 @@
+package output
+
+import (
+	"github.com/shopify/sarama"
+	"logagent/kafka"
+	"logagent/module"
+)
+
+func init() {
+	Register("kafka", newKafkaOutput)
+}
+
+//kafkaOutput 按消息的topic发送到kafka
+type kafkaOutput struct {
+	producer *kafka.Producer
+}
+
+func newKafkaOutput(conf module.OutputConf) (Output, error) {
+	producer, err := kafka.NewProducer(conf.KafkaAddr, conf.KafkaVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaOutput{producer: producer}, nil
+}
+
+func (k *kafkaOutput) Send(msgs []*module.TextMsg) error {
+	batch := make([]*sarama.ProducerMessage, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = &sarama.ProducerMessage{
+			Topic:     msg.Topic,
+			Value:     sarama.StringEncoder(msg.Value()),
+			Timestamp: msg.Time,
+			Metadata:  i,
+		}
+	}
+	err := k.producer.SendMessages(batch)
+	if err == nil {
+		return nil
+	}
+	perrs, ok := err.(sarama.ProducerErrors)
+	if !ok {
+		if !kafka.IsRetriable(err) {
+			return Permanent(err)
+		}
+		return err
+	}
+	errs := make([]error, len(msgs))
+	for _, perr := range perrs {
+		i, ok := perr.Msg.Metadata.(int)
+		if !ok {
+			continue
+		}
+		errs[i] = perr.Err
+		if !kafka.IsRetriable(perr.Err) {
+			errs[i] = Permanent(perr.Err)
+		}
+	}
+	return &BatchError{Errors: errs}
+}
+
+//Flush 同步发送,没有内部缓存
+func (k *kafkaOutput) Flush() error {
+	return nil
+}
+
+func (k *kafkaOutput) Close() error {
+	return k.producer.Close()
+}
+
+func (k *kafkaOutput) Health() error {
+	return k.producer.Health()
+}
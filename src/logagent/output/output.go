@@ -0,0 +1,113 @@
+package output
+
+import (
+	"fmt"
+	"logagent/module"
+	"time"
+)
+
+//Output 一种输出,由Sink负责缓冲,批量和重试
+type Output interface {
+	//Send 发送一批消息,部分消息失败时返回*BatchError
+	Send(msgs []*module.TextMsg) error
+	//Flush 把内部缓存的数据写出去,缓冲区空闲时调用
+	Flush() error
+	Close() error
+	//Health 检查输出当前是否可用,nil表示正常
+	Health() error
+}
+
+//Factory 按配置创建输出
+type Factory func(conf module.OutputConf) (Output, error)
+
+var factories = map[string]Factory{}
+
+//Register 注册一种输出类型
+func Register(typ string, f Factory) {
+	factories[typ] = f
+}
+
+func newOutput(conf module.OutputConf) (Output, error) {
+	f, ok := factories[conf.Type]
+	if !ok {
+		return nil, fmt.Errorf("invalid output type:%s,output:%s", conf.Type, conf.Name)
+	}
+	return f(conf)
+}
+
+//BatchError 一批消息中部分发送失败,Errors与消息一一对应,成功的为nil
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return fmt.Sprintf("%d of %d messages failed,first err:%v", failed, len(e.Errors), first)
+}
+
+//permanentError 重试也不会成功的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+//Permanent 标记为不可重试的错误,Sink会直接写入死信
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+//IsPermanent 判断是否为不可重试的错误
+func IsPermanent(err error) bool {
+	_, ok := err.(*permanentError)
+	return ok
+}
+
+//retryAfterError 可以重试,但服务端要求至少等待after
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+//RetryAfter 标记重试前至少等待after,after不大于0时原样返回
+func RetryAfter(err error, after time.Duration) error {
+	if err == nil || after <= 0 {
+		return err
+	}
+	return &retryAfterError{err: err, after: after}
+}
+
+//retryDelay 返回错误要求的最少等待时间,部分失败时取最大值
+func retryDelay(err error) time.Duration {
+	switch e := err.(type) {
+	case *retryAfterError:
+		return e.after
+	case *BatchError:
+		var max time.Duration
+		for _, item := range e.Errors {
+			if d := retryDelay(item); d > max {
+				max = d
+			}
+		}
+		return max
+	}
+	return 0
+}
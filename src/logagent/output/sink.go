@@ -0,0 +1,348 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"logagent/metrics"
+	"logagent/module"
+	"logagent/queue"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//DeadLetterFunc 保存发送失败的消息
+type DeadLetterFunc func(msg *module.TextMsg, output string, reason error, attempts int, retriable bool)
+
+var errBufferFull = errors.New("output buffer full")
+
+//delivery 一条消息分发给多个输出,全部输出处理完后才算处理完
+type delivery struct {
+	msg       *module.TextMsg
+	remaining int32
+	failed    int32
+}
+
+//finish 一个输出处理完这条消息,最后一个输出处理完时释放队列中的消息
+func (d *delivery) finish(ok bool) {
+	if !ok {
+		atomic.StoreInt32(&d.failed, 1)
+	}
+	if atomic.AddInt32(&d.remaining, -1) > 0 {
+		return
+	}
+	if atomic.LoadInt32(&d.failed) == 1 {
+		atomic.AddInt64(&failed, 1)
+	}
+	queue.Done(d.msg)
+}
+
+//Sink 一个输出的缓冲区和发送协程,输出之间互不影响
+type Sink struct {
+	conf module.OutputConf
+	out  Output
+	ch   chan *delivery
+	//配置了topics时只接收这些topic的消息
+	topics map[string]bool
+	//发送协程退出后关闭
+	done chan struct{}
+	//block模式下等待超时后置为1,缓冲区有空位前不再等待
+	stalled int32
+
+	lk      sync.Mutex
+	lastErr error
+	errTime time.Time
+}
+
+//SinkStatus 输出的状态
+type SinkStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Buffered  int    `json:"buffered"`
+	Healthy   bool   `json:"healthy"`
+	Error     string `json:"error,omitempty"`
+	ErrorTime string `json:"error_time,omitempty"`
+}
+
+var (
+	sinks      = make(map[string]*Sink)
+	sinkOrder  []*Sink
+	taskSinks  = make(map[string][]*Sink)
+	deadLetter DeadLetterFunc
+	//至少有一个输出没有发送成功的消息数
+	failed int64
+)
+
+//Init 创建所有输出,按收集任务的outputs配置分发消息
+func Init(config *module.Config, dl DeadLetterFunc) error {
+	deadLetter = dl
+	for _, conf := range config.Outputs {
+		out, err := newOutput(conf)
+		if err != nil {
+			logs.Error("init output failed,output:%s,err:%v", conf.Name, err)
+			return err
+		}
+		s := &Sink{
+			conf: conf,
+			out:  out,
+			ch:   make(chan *delivery, conf.BufferSize),
+			done: make(chan struct{}),
+		}
+		if len(conf.Topics) > 0 {
+			s.topics = make(map[string]bool)
+			for _, topic := range conf.Topics {
+				s.topics[topic] = true
+			}
+		}
+		sinks[conf.Name] = s
+		sinkOrder = append(sinkOrder, s)
+		metrics.GaugeFunc("output."+conf.Name+".buffered", func() int64 {
+			return int64(len(s.ch))
+		})
+		go s.run()
+	}
+
+	for _, cc := range config.Collect {
+		names := cc.Outputs
+		if len(names) == 0 {
+			taskSinks[cc.Name] = sinkOrder
+			continue
+		}
+		for _, name := range names {
+			s, ok := sinks[name]
+			if !ok {
+				return fmt.Errorf("output %s of collect task %s not found", name, cc.Name)
+			}
+			taskSinks[cc.Name] = append(taskSinks[cc.Name], s)
+		}
+	}
+	return nil
+}
+
+//Dispatch 把消息放入所属任务的各个输出的缓冲区
+func Dispatch(msg *module.TextMsg) {
+	list := taskSinks[msg.Task]
+	if len(list) == 0 {
+		metrics.Inc("output.unrouted", 1)
+		logs.Warn("no output for task %s,drop message", msg.Task)
+		atomic.AddInt64(&failed, 1)
+		queue.Done(msg)
+		return
+	}
+	d := &delivery{msg: msg, remaining: int32(len(list))}
+	for _, s := range list {
+		s.put(d)
+	}
+}
+
+//put 缓冲区满时按overflow配置等待或者写入死信,不接收的topic直接算处理完
+//所有输出共用一个分发协程,block模式下也只等待block_timeout,
+//超时后直到缓冲区有空位前都直接写入死信,一个输出不可用时不会拖住其他输出
+func (s *Sink) put(d *delivery) {
+	if s.topics != nil && !s.topics[d.msg.Topic] {
+		d.finish(true)
+		return
+	}
+	select {
+	case s.ch <- d:
+		if atomic.CompareAndSwapInt32(&s.stalled, 1, 0) {
+			logs.Info("output buffer drained,output:%s", s.conf.Name)
+		}
+		return
+	default:
+	}
+	if s.conf.Overflow != "deadletter" && atomic.LoadInt32(&s.stalled) == 0 {
+		timer := time.NewTimer(s.conf.BlockTimeout)
+		select {
+		case s.ch <- d:
+			timer.Stop()
+			return
+		case <-timer.C:
+			atomic.StoreInt32(&s.stalled, 1)
+			logs.Warn("output buffer full for %v,write to dead letter until it drains,output:%s",
+				s.conf.BlockTimeout, s.conf.Name)
+		}
+	}
+	metrics.Inc("output."+s.conf.Name+".overflow", 1)
+	s.fail(d, errBufferFull, 0, true)
+}
+
+//run 攒够batch_size条或者等待flush_interval后发送一批,缓冲区关闭后发完剩下的消息退出
+func (s *Sink) run() {
+	defer close(s.done)
+	batch := make([]*delivery, 0, s.conf.BatchSize)
+	timer := time.NewTimer(s.conf.FlushInterval)
+	for {
+		d, ok := <-s.ch
+		if !ok {
+			s.flush()
+			return
+		}
+		batch = append(batch[:0], d)
+		timer.Reset(s.conf.FlushInterval)
+		closed := false
+	collect:
+		for len(batch) < s.conf.BatchSize {
+			select {
+			case d, ok := <-s.ch:
+				if !ok {
+					closed = true
+					break collect
+				}
+				batch = append(batch, d)
+			case <-timer.C:
+				break collect
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		s.send(batch)
+		if closed {
+			s.flush()
+			return
+		}
+		if len(s.ch) == 0 {
+			s.flush()
+		}
+	}
+}
+
+func (s *Sink) flush() {
+	if err := s.out.Flush(); err != nil {
+		logs.Warn("flush output failed,output:%s,err:%v", s.conf.Name, err)
+		s.setError(err)
+	}
+}
+
+//send 发送一批消息,可重试的失败按指数退避只重试失败的部分,
+//重试次数用完或者不可重试时写入死信
+func (s *Sink) send(batch []*delivery) {
+	name := s.conf.Name
+	backoff := s.conf.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		msgs := make([]*module.TextMsg, len(batch))
+		for i, d := range batch {
+			msgs[i] = d.msg
+		}
+		err := s.out.Send(msgs)
+		if err == nil {
+			metrics.Inc("output."+name+".sent", int64(len(batch)))
+			s.setError(nil)
+			for _, d := range batch {
+				d.finish(true)
+			}
+			return
+		}
+		s.setError(err)
+
+		var retry []*delivery
+		for i, d := range batch {
+			e := err
+			if berr, ok := err.(*BatchError); ok {
+				e = berr.Errors[i]
+			}
+			switch {
+			case e == nil:
+				metrics.Inc("output."+name+".sent", 1)
+				d.finish(true)
+			case IsPermanent(e):
+				metrics.Inc("output."+name+".permanent_errors", 1)
+				s.fail(d, e, attempt, false)
+			case attempt > s.conf.SendRetries:
+				metrics.Inc("output."+name+".retries_exhausted", 1)
+				s.fail(d, e, attempt, true)
+			default:
+				retry = append(retry, d)
+			}
+		}
+		if len(retry) == 0 {
+			return
+		}
+
+		//服务端通过Retry-After要求等待更久时按它的要求,但不超过retry_max_backoff
+		wait := backoff
+		if d := retryDelay(err); d > wait {
+			wait = d
+		}
+		if max := s.conf.RetryMaxBackoff; max > 0 && wait > max {
+			wait = max
+		}
+		metrics.Inc("output."+name+".retries", int64(len(retry)))
+		logs.Warn("send to output failed,retry after %v,output:%s,attempt:%d,messages:%d,err:%v",
+			wait, name, attempt, len(retry), err)
+		time.Sleep(wait)
+		backoff *= 2
+		if backoff > s.conf.RetryMaxBackoff {
+			backoff = s.conf.RetryMaxBackoff
+		}
+		batch = retry
+	}
+}
+
+func (s *Sink) fail(d *delivery, reason error, attempts int, retriable bool) {
+	if deadLetter != nil {
+		deadLetter(d.msg, s.conf.Name, reason, attempts, retriable)
+	}
+	d.finish(false)
+}
+
+func (s *Sink) setError(err error) {
+	s.lk.Lock()
+	s.lastErr = err
+	if err != nil {
+		s.errTime = time.Now()
+	}
+	s.lk.Unlock()
+}
+
+//Status 返回各个输出的状态,最近一次发送失败或者输出自身检查失败时为不健康
+func Status() []SinkStatus {
+	list := make([]SinkStatus, 0, len(sinkOrder))
+	for _, s := range sinkOrder {
+		st := SinkStatus{
+			Name:     s.conf.Name,
+			Type:     s.conf.Type,
+			Buffered: len(s.ch),
+			Healthy:  true,
+		}
+		s.lk.Lock()
+		err := s.lastErr
+		if err != nil {
+			st.ErrorTime = s.errTime.Format(time.RFC3339)
+		}
+		s.lk.Unlock()
+		if err == nil {
+			err = s.out.Health()
+		}
+		if err != nil {
+			st.Healthy = false
+			st.Error = err.Error()
+		}
+		list = append(list, st)
+	}
+	return list
+}
+
+//Failed 返回至少有一个输出没有发送成功的消息数
+func Failed() int64 {
+	return atomic.LoadInt64(&failed)
+}
+
+//Close 发完缓冲区中的消息后关闭所有输出,调用后不能再Dispatch
+func Close() {
+	for _, s := range sinkOrder {
+		close(s.ch)
+	}
+	for _, s := range sinkOrder {
+		<-s.done
+		if err := s.out.Close(); err != nil {
+			logs.Warn("close output failed,output:%s,err:%v", s.conf.Name, err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"logagent/module"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//fakeOutput 记录收到的消息,result决定每次发送的结果,block不为空时发送一直阻塞
+type fakeOutput struct {
+	lk       sync.Mutex
+	sent     []string
+	attempts int
+	result   func(attempt int, msgs []*module.TextMsg) error
+	block    chan struct{}
+}
+
+func (f *fakeOutput) Send(msgs []*module.TextMsg) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.attempts++
+	var err error
+	if f.result != nil {
+		err = f.result(f.attempts, msgs)
+	}
+	berr, partial := err.(*BatchError)
+	for i, msg := range msgs {
+		if err == nil || (partial && berr.Errors[i] == nil) {
+			f.sent = append(f.sent, msg.Msg)
+		}
+	}
+	return err
+}
+
+func (f *fakeOutput) Flush() error  { return nil }
+func (f *fakeOutput) Close() error  { return nil }
+func (f *fakeOutput) Health() error { return nil }
+
+func (f *fakeOutput) list() []string {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return append([]string(nil), f.sent...)
+}
+
+//deadLetters 记录写入死信的消息
+type deadLetters struct {
+	lk   sync.Mutex
+	msgs map[string]error
+}
+
+func captureDeadLetters(t *testing.T) *deadLetters {
+	dl := &deadLetters{msgs: make(map[string]error)}
+	old := deadLetter
+	deadLetter = func(msg *module.TextMsg, output string, reason error, attempts int, retriable bool) {
+		dl.lk.Lock()
+		dl.msgs[msg.Msg] = reason
+		dl.lk.Unlock()
+	}
+	t.Cleanup(func() { deadLetter = old })
+	return dl
+}
+
+func (dl *deadLetters) count() int {
+	dl.lk.Lock()
+	defer dl.lk.Unlock()
+	return len(dl.msgs)
+}
+
+func testSink(conf module.OutputConf, out Output) *Sink {
+	if len(conf.Name) == 0 {
+		conf.Name = "test"
+	}
+	if conf.BatchSize == 0 {
+		conf.BatchSize = 10
+	}
+	if conf.FlushInterval == 0 {
+		conf.FlushInterval = 10 * time.Millisecond
+	}
+	if conf.BlockTimeout == 0 {
+		conf.BlockTimeout = 50 * time.Millisecond
+	}
+	if conf.RetryBackoff == 0 {
+		conf.RetryBackoff = time.Millisecond
+	}
+	if conf.RetryMaxBackoff == 0 {
+		conf.RetryMaxBackoff = 10 * time.Millisecond
+	}
+	s := &Sink{
+		conf: conf,
+		out:  out,
+		ch:   make(chan *delivery, conf.BufferSize),
+		done: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Sink) stop() {
+	close(s.ch)
+	<-s.done
+}
+
+//TestSinkBlockTimeout 一个输出阻塞时,分发最多等待一次block_timeout,其他输出照常发送
+func TestSinkBlockTimeout(t *testing.T) {
+	dl := captureDeadLetters(t)
+	stuck := &fakeOutput{block: make(chan struct{})}
+	healthy := &fakeOutput{}
+	a := testSink(module.OutputConf{Name: "stuck", BufferSize: 1, BatchSize: 1}, stuck)
+	b := testSink(module.OutputConf{Name: "healthy", BufferSize: 100}, healthy)
+
+	start := time.Now()
+	const total = 50
+	for i := 0; i < total; i++ {
+		d := &delivery{msg: &module.TextMsg{Msg: fmt.Sprintf("m%d", i)}, remaining: 2}
+		a.put(d)
+		b.put(d)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("dispatch took %v with one stuck output", elapsed)
+	}
+	//stuck输出正在发送一条,缓冲区中一条,其余都写入死信
+	if n := dl.count(); n != total-2 {
+		t.Errorf("dead letters = %d, want %d", n, total-2)
+	}
+
+	//恢复后缓冲区有空位,不再写入死信
+	close(stuck.block)
+	for i := 0; i < 100 && len(a.ch) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.put(&delivery{msg: &module.TextMsg{Msg: "after"}, remaining: 1})
+	if atomic.LoadInt32(&a.stalled) != 0 {
+		t.Error("stalled flag should be cleared after the buffer drained")
+	}
+	a.stop()
+	b.stop()
+	if n := len(healthy.list()); n != total {
+		t.Errorf("healthy output got %d messages, want %d", n, total)
+	}
+	if n := len(stuck.list()); n != 3 {
+		t.Errorf("stuck output got %d messages after recovery, want 3", n)
+	}
+}
+
+func TestSinkRetry(t *testing.T) {
+	errRetry := errors.New("temporary")
+	tests := []struct {
+		name    string
+		retries int
+		result  func(attempt int, msgs []*module.TextMsg) error
+		sent    int
+		dead    int
+	}{
+		{"success", 3, nil, 2, 0},
+		{
+			"retry until success", 3,
+			func(attempt int, msgs []*module.TextMsg) error {
+				if attempt < 3 {
+					return errRetry
+				}
+				return nil
+			},
+			2, 0,
+		},
+		{
+			"retries exhausted", 2,
+			func(attempt int, msgs []*module.TextMsg) error { return errRetry },
+			0, 2,
+		},
+		{
+			"permanent item not retried", 3,
+			func(attempt int, msgs []*module.TextMsg) error {
+				errs := make([]error, len(msgs))
+				for i, msg := range msgs {
+					if msg.Msg == "bad" {
+						errs[i] = Permanent(errors.New("rejected"))
+					}
+				}
+				return &BatchError{Errors: errs}
+			},
+			1, 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := captureDeadLetters(t)
+			out := &fakeOutput{result: tt.result}
+			s := testSink(module.OutputConf{BufferSize: 10, SendRetries: tt.retries}, out)
+			for _, text := range []string{"good", "bad"} {
+				s.put(&delivery{msg: &module.TextMsg{Msg: text}, remaining: 1})
+			}
+			s.stop()
+			if n := len(out.list()); n != tt.sent {
+				t.Errorf("sent %d, want %d", n, tt.sent)
+			}
+			if n := dl.count(); n != tt.dead {
+				t.Errorf("dead letters %d, want %d", n, tt.dead)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package output
+
+import (
+	"fmt"
+	"logagent/module"
+	"logagent/process"
+	"strings"
+	"time"
+)
+
+//template 按消息生成字符串,%{name}替换为topic,task,source,message或者同名字段,
+//%Y,%m,%d等strftime指令替换为事件时间(UTC),没有事件时间时使用当前时间
+type template struct {
+	parts []func(msg *module.TextMsg, t time.Time) string
+	//不为空时%{name}替换的值先经过escape处理
+	escape func(string) string
+}
+
+func newTemplate(s string) (*template, error) {
+	tpl := &template{}
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			text := literal.String()
+			tpl.parts = append(tpl.parts, func(*module.TextMsg, time.Time) string { return text })
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			literal.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return nil, fmt.Errorf("invalid template:%s", s)
+		}
+		if s[i] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid template:%s", s)
+			}
+			name := s[i+1 : i+end]
+			i += end
+			flush()
+			tpl.parts = append(tpl.parts, func(msg *module.TextMsg, _ time.Time) string {
+				if tpl.escape != nil {
+					return tpl.escape(lookup(msg, name))
+				}
+				return lookup(msg, name)
+			})
+			continue
+		}
+		layout, ok := process.StrftimeLayout(s[i])
+		if !ok {
+			return nil, fmt.Errorf("unsupported directive %%%c in template %s", s[i], s)
+		}
+		if layout == "%" {
+			literal.WriteByte('%')
+			continue
+		}
+		flush()
+		tpl.parts = append(tpl.parts, func(_ *module.TextMsg, t time.Time) string {
+			return t.Format(layout)
+		})
+	}
+	flush()
+	return tpl, nil
+}
+
+//lookup 取消息的属性或字段,不存在时为空
+func lookup(msg *module.TextMsg, name string) string {
+	switch name {
+	case "topic":
+		return msg.Topic
+	case "task":
+		return msg.Task
+	case "source":
+		return msg.Source
+	case "message":
+		return msg.Msg
+	}
+	v, ok := msg.Fields[name]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func (tpl *template) render(msg *module.TextMsg) string {
+	t := msg.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	t = t.UTC()
+	var b strings.Builder
+	for _, part := range tpl.parts {
+		b.WriteString(part(msg, t))
+	}
+	return b.String()
+}
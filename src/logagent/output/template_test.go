@@ -0,0 +1,56 @@
+package output
+
+import (
+	"logagent/module"
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	msg := &module.TextMsg{
+		Msg:    "hello",
+		Topic:  "nginx",
+		Task:   "web",
+		Source: "/var/log/nginx/access.log",
+		Time:   time.Date(2024, 3, 5, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600)),
+		Fields: map[string]interface{}{"status": 404, "empty": nil},
+	}
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{"logs-%{topic}-%Y.%m.%d", "logs-nginx-2024.03.06"},
+		{"%{task}:%{source}", "web:/var/log/nginx/access.log"},
+		{"%{message} %{status} [%{missing}] [%{empty}]", "hello 404 [] []"},
+		{"%H:%M 100%%", "01:30 100%"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		tpl, err := newTemplate(tt.tpl)
+		if err != nil {
+			t.Errorf("newTemplate(%q) err %v", tt.tpl, err)
+			continue
+		}
+		if got := tpl.render(msg); got != tt.want {
+			t.Errorf("render(%q) = %q, want %q", tt.tpl, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"logs-%", "logs-%{topic", "logs-%Q"} {
+		if _, err := newTemplate(bad); err == nil {
+			t.Errorf("newTemplate(%q) should fail", bad)
+		}
+	}
+}
+
+func TestTemplateEscape(t *testing.T) {
+	tpl, err := newTemplate(`{"text":"%{message}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.escape = jsonEscape
+	got := tpl.render(&module.TextMsg{Msg: "a \"quoted\"\nline"})
+	if want := `{"text":"a \"quoted\"\nline"}`; got != want {
+		t.Errorf("render = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"logagent/module"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	Register("webhook", newWebhookOutput)
+}
+
+//webhookOutput 把一批消息作为一个请求发送到http服务
+type webhookOutput struct {
+	conf    module.OutputConf
+	body    *template
+	headers http.Header
+	client  *http.Client
+}
+
+func newWebhookOutput(conf module.OutputConf) (Output, error) {
+	w := &webhookOutput{conf: conf, headers: make(http.Header)}
+	if len(conf.BodyTemplate) > 0 {
+		body, err := newTemplate(conf.BodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		//模板一般是json,替换的值需要转义
+		body.escape = jsonEscape
+		w.body = body
+	}
+	for _, h := range conf.Headers {
+		i := strings.IndexByte(h, ':')
+		if i <= 0 {
+			continue
+		}
+		w.headers.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+	client, err := newHTTPClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	w.client = client
+	return w, nil
+}
+
+//jsonEscape 转成json字符串中的内容,不带两边的引号
+func jsonEscape(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+func (w *webhookOutput) Send(msgs []*module.TextMsg) error {
+	errs := make([]error, len(msgs))
+	var events [][]byte
+	for i, msg := range msgs {
+		event, err := w.event(msg)
+		if err != nil {
+			errs[i] = Permanent(err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(events) > 0 {
+		if err := w.post(w.encode(events)); err != nil {
+			if len(events) == len(msgs) {
+				return err
+			}
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = err
+				}
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+//event 有body_template时按模板生成,否则与elasticsearch输出的文档相同
+func (w *webhookOutput) event(msg *module.TextMsg) ([]byte, error) {
+	if w.body != nil {
+		return []byte(w.body.render(msg)), nil
+	}
+	return document(msg)
+}
+
+//encode json格式拼成数组,ndjson每行一条
+func (w *webhookOutput) encode(events [][]byte) []byte {
+	var buf bytes.Buffer
+	if w.conf.WebhookFormat == "ndjson" {
+		for _, event := range events {
+			buf.Write(event)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+	buf.WriteByte('[')
+	for i, event := range events {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(event)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+func (w *webhookOutput) post(data []byte) error {
+	var body io.Reader = bytes.NewReader(data)
+	if w.conf.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = &buf
+	}
+	req, err := http.NewRequest(w.conf.Method, w.conf.URL, body)
+	if err != nil {
+		return Permanent(err)
+	}
+	for k, v := range w.headers {
+		req.Header[k] = v
+	}
+	if len(req.Header.Get("Content-Type")) == 0 {
+		if w.conf.WebhookFormat == "ndjson" {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if w.conf.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	setAuth(req, w.conf)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError(resp, respBody, w.conf.RetryMaxBackoff)
+	}
+	return nil
+}
+
+//Flush 每批同步发送,没有内部缓存
+func (w *webhookOutput) Flush() error {
+	return nil
+}
+
+func (w *webhookOutput) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+//Health 发送结果由Sink记录,这里不额外检查
+func (w *webhookOutput) Health() error {
+	return nil
+}
@@ -0,0 +1,170 @@
+package output
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"logagent/module"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+//webhookRequest 测试服务收到的请求
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+func newWebhookServer(t *testing.T, status func(n int) (int, string)) (*httptest.Server, func() []webhookRequest) {
+	var lk sync.Mutex
+	var reqs []webhookRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		data, _ := ioutil.ReadAll(body)
+		lk.Lock()
+		reqs = append(reqs, webhookRequest{method: r.Method, header: r.Header, body: string(data)})
+		n := len(reqs)
+		lk.Unlock()
+		if status != nil {
+			code, retryAfter := status(n)
+			if len(retryAfter) > 0 {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(code)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []webhookRequest {
+		lk.Lock()
+		defer lk.Unlock()
+		return append([]webhookRequest(nil), reqs...)
+	}
+}
+
+func TestWebhookBody(t *testing.T) {
+	msgs := []*module.TextMsg{
+		{Msg: `say "hi"`, Topic: "app", Time: time.Date(2024, 3, 5, 1, 2, 3, 0, time.UTC)},
+		{Msg: "x", Topic: "app", Fields: map[string]interface{}{"level": "error", "@timestamp": "t"}},
+	}
+	tests := []struct {
+		name        string
+		conf        module.OutputConf
+		contentType string
+		body        string
+	}{
+		{
+			"json array", module.OutputConf{},
+			"application/json",
+			`[{"@timestamp":"2024-03-05T01:02:03Z","message":"say \"hi\""},{"@timestamp":"t","level":"error"}]`,
+		},
+		{
+			"ndjson gzip", module.OutputConf{WebhookFormat: "ndjson", Gzip: true},
+			"application/x-ndjson",
+			"{\"@timestamp\":\"2024-03-05T01:02:03Z\",\"message\":\"say \\\"hi\\\"\"}\n{\"@timestamp\":\"t\",\"level\":\"error\"}\n",
+		},
+		{
+			"template with custom content type",
+			module.OutputConf{
+				BodyTemplate: `{"text":"[%{topic}] %{message} %{level}"}`,
+				Headers:      []string{"Content-Type: text/plain", "X-Token: abc", "invalid"},
+			},
+			"text/plain",
+			`[{"text":"[app] say \"hi\" "},{"text":"[app] x error"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newWebhookServer(t, nil)
+			conf := tt.conf
+			conf.Name = "webhook"
+			conf.URL = srv.URL
+			conf.Method = http.MethodPut
+			out, err := newWebhookOutput(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := out.Send(msgs); err != nil {
+				t.Fatal(err)
+			}
+			reqs := requests()
+			if len(reqs) != 1 {
+				t.Fatalf("got %d requests, want 1", len(reqs))
+			}
+			req := reqs[0]
+			if req.method != http.MethodPut || req.header.Get("Content-Type") != tt.contentType {
+				t.Errorf("request %s %s, want PUT %s", req.method, req.header.Get("Content-Type"), tt.contentType)
+			}
+			if req.body != tt.body {
+				t.Errorf("body = %s\nwant %s", req.body, tt.body)
+			}
+			if len(conf.Headers) > 0 && req.header.Get("X-Token") != "abc" {
+				t.Errorf("X-Token header = %q", req.header.Get("X-Token"))
+			}
+		})
+	}
+}
+
+//TestWebhookRetryAfter Sink按Retry-After等待,但不超过retry_max_backoff
+func TestWebhookRetryAfter(t *testing.T) {
+	srv, requests := newWebhookServer(t, func(n int) (int, string) {
+		if n == 1 {
+			return http.StatusTooManyRequests, "3600"
+		}
+		return http.StatusOK, ""
+	})
+	out, err := newWebhookOutput(module.OutputConf{Name: "webhook", URL: srv.URL, Method: http.MethodPost,
+		RetryMaxBackoff: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := captureDeadLetters(t)
+	s := testSink(module.OutputConf{BufferSize: 10, SendRetries: 3, RetryMaxBackoff: 50 * time.Millisecond}, out)
+
+	start := time.Now()
+	s.put(&delivery{msg: &module.TextMsg{Msg: "a"}, remaining: 1})
+	s.stop()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("retry waited %v, Retry-After not clamped", elapsed)
+	}
+	if n := len(requests()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	if dl.count() != 0 {
+		t.Errorf("unexpected dead letters %v", dl.msgs)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNoContent, false},
+		{http.StatusBadRequest, true},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		srv, _ := newWebhookServer(t, func(int) (int, string) { return tt.status, "" })
+		out, err := newWebhookOutput(module.OutputConf{Name: "webhook", URL: srv.URL, Method: http.MethodPost})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = out.Send([]*module.TextMsg{{Msg: "a"}})
+		if ok := tt.status < 300; (err == nil) != ok || IsPermanent(err) != tt.permanent {
+			t.Errorf("status %d: err = %v, permanent %v", tt.status, err, IsPermanent(err))
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package process
+
+import (
+	"container/list"
+	"fmt"
+	"logagent/memory"
+	"logagent/metrics"
+	"logagent/module"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var numberRegexp = regexp.MustCompile(`\d+`)
+
+//dedupEntry 一个key的窗口,第一次出现的行已经发出,只缓存第一条重复的行和重复次数
+type dedupEntry struct {
+	key string
+	//第一条重复的行,窗口结束时作为汇总发出,没有重复时为nil
+	msg   *module.TextMsg
+	count int
+	first time.Time
+	last  time.Time
+	//按收到的时间计算窗口,事件时间可能是很久以前的
+	deadline time.Time
+	//key和缓存的行占用的内存
+	size int64
+}
+
+//deduper 第一次出现的行直接通过,窗口内重复的行合并成一条汇总,
+//窗口按第一次出现的顺序结束,超过dedup_max_keys时提前结束最早的窗口
+type deduper struct {
+	task      string
+	window    time.Duration
+	normalize bool
+	maxKeys   int
+	emit      func(msg *module.TextMsg)
+
+	lk      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	//被挤出的窗口,由expireLoop发出
+	evicted []*dedupEntry
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newDeduper(conf module.CollectConf) (*deduper, error) {
+	d := &deduper{
+		task:      conf.Name,
+		window:    5 * time.Second,
+		normalize: conf.DedupNormalize,
+		maxKeys:   conf.DedupMaxKeys,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+		kick:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if len(conf.DedupWindow) > 0 {
+		window, err := time.ParseDuration(conf.DedupWindow)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid dedup_window:%s", conf.DedupWindow)
+		}
+		d.window = window
+	}
+	if d.maxKeys <= 0 {
+		d.maxKeys = 10000
+	}
+	return d, nil
+}
+
+//SetEmit 汇总只在expireLoop和Close中发出,Process中不会调用emit
+func (d *deduper) SetEmit(emit func(msg *module.TextMsg)) {
+	d.emit = emit
+	go d.expireLoop()
+}
+
+func (d *deduper) emitAsync() {}
+
+//key 不同来源的相同内容分开合并
+func (d *deduper) key(msg *module.TextMsg) string {
+	text := msg.Msg
+	if d.normalize {
+		text = numberRegexp.ReplaceAllString(text, "#")
+	}
+	return msg.Source + "\x00" + text
+}
+
+//Process 第一次出现的行直接通过,窗口内重复的行只计数
+//在处理链的锁内执行,内存不够时不等待,不缓存直接放行
+func (d *deduper) Process(msg *module.TextMsg) bool {
+	now := msg.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := d.key(msg)
+
+	d.lk.Lock()
+	if elem, ok := d.entries[key]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if entry.msg == nil {
+			size := msg.Size()
+			if !memory.TryAcquire(size) {
+				d.lk.Unlock()
+				metrics.Inc("dedup."+d.task+".memory_full", 1)
+				return true
+			}
+			//汇总发出之后才确认这一行,避免汇总还没发送就推进了读取进度
+			if msg.Ack != nil {
+				msg.Ack.Add()
+			}
+			entry.msg = msg
+			entry.first = now
+			entry.size += size
+		}
+		entry.count++
+		entry.last = now
+		d.lk.Unlock()
+		metrics.Inc("dedup."+d.task+".collapsed", 1)
+		return false
+	}
+	size := int64(len(key))
+	if !memory.TryAcquire(size) {
+		d.lk.Unlock()
+		metrics.Inc("dedup."+d.task+".memory_full", 1)
+		return true
+	}
+	entry := &dedupEntry{key: key, deadline: time.Now().Add(d.window), size: size}
+	d.entries[key] = d.order.PushBack(entry)
+	evicted := false
+	if d.order.Len() > d.maxKeys {
+		d.evicted = append(d.evicted, d.remove(d.order.Front()))
+		evicted = true
+	}
+	d.lk.Unlock()
+
+	if evicted {
+		select {
+		case d.kick <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+func (d *deduper) remove(elem *list.Element) *dedupEntry {
+	entry := d.order.Remove(elem).(*dedupEntry)
+	delete(d.entries, entry.key)
+	return entry
+}
+
+//flush 有重复时发出汇总,repeat_count为第一次之后重复的次数
+func (d *deduper) flush(entry *dedupEntry) {
+	memory.Release(entry.size)
+	if entry.msg == nil {
+		return
+	}
+	msg := entry.msg
+	msg.SetField("repeat_count", entry.count)
+	msg.SetField("first_timestamp", entry.first.Format(time.RFC3339Nano))
+	msg.SetField("last_timestamp", entry.last.Format(time.RFC3339Nano))
+	d.emit(msg)
+	//放入队列时已经增加了引用,释放缓存时持有的引用
+	if msg.Ack != nil {
+		msg.Ack.Done()
+	}
+}
+
+func (d *deduper) expireLoop() {
+	defer close(d.done)
+	interval := d.window / 2
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.expire(time.Now())
+		case <-d.kick:
+			d.expire(time.Now())
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+//expire 按第一次出现的顺序发出被挤出的和窗口已经结束的汇总
+func (d *deduper) expire(now time.Time) {
+	d.lk.Lock()
+	expired := d.evicted
+	d.evicted = nil
+	for elem := d.order.Front(); elem != nil; elem = d.order.Front() {
+		if now.Before(elem.Value.(*dedupEntry).deadline) {
+			break
+		}
+		expired = append(expired, d.remove(elem))
+	}
+	d.lk.Unlock()
+
+	for _, entry := range expired {
+		d.flush(entry)
+	}
+}
+
+//Close 等expireLoop退出后发出所有缓存的汇总
+func (d *deduper) Close() {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+	if d.emit != nil {
+		<-d.done
+	}
+	d.lk.Lock()
+	pending := d.evicted
+	d.evicted = nil
+	for elem := d.order.Front(); elem != nil; elem = d.order.Front() {
+		pending = append(pending, d.remove(elem))
+	}
+	d.lk.Unlock()
+
+	for _, entry := range pending {
+		d.flush(entry)
+	}
+}
@@ -0,0 +1,209 @@
+package process
+
+import (
+	"logagent/memory"
+	"logagent/module"
+	"sync"
+	"testing"
+	"time"
+)
+
+//collector 记录emit发出的消息
+type collector struct {
+	lk   sync.Mutex
+	msgs []*module.TextMsg
+}
+
+func (c *collector) emit(msg *module.TextMsg) {
+	c.lk.Lock()
+	c.msgs = append(c.msgs, msg)
+	c.lk.Unlock()
+}
+
+func (c *collector) list() []*module.TextMsg {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return append([]*module.TextMsg(nil), c.msgs...)
+}
+
+func TestDedup(t *testing.T) {
+	type line struct {
+		source, text string
+	}
+	type summary struct {
+		source, text string
+		count        int
+	}
+	tests := []struct {
+		name      string
+		conf      module.CollectConf
+		lines     []line
+		forwarded []bool
+		summaries []summary
+	}{
+		{
+			name:      "first occurrence forwarded",
+			lines:     []line{{"a", "x"}, {"a", "y"}, {"a", "x"}, {"a", "x"}},
+			forwarded: []bool{true, true, false, false},
+			summaries: []summary{{"a", "x", 2}},
+		},
+		{
+			name:      "source in key",
+			lines:     []line{{"a", "x"}, {"b", "x"}, {"a", "x"}},
+			forwarded: []bool{true, true, false},
+			summaries: []summary{{"a", "x", 1}},
+		},
+		{
+			name:      "summaries in first seen order",
+			lines:     []line{{"a", "x"}, {"a", "y"}, {"a", "y"}, {"a", "x"}},
+			forwarded: []bool{true, true, false, false},
+			summaries: []summary{{"a", "x", 1}, {"a", "y", 1}},
+		},
+		{
+			name:      "normalize numbers",
+			conf:      module.CollectConf{DedupNormalize: true},
+			lines:     []line{{"a", "took 12ms"}, {"a", "took 7ms"}},
+			forwarded: []bool{true, false},
+			summaries: []summary{{"a", "took 7ms", 1}},
+		},
+		{
+			name:      "evict oldest",
+			conf:      module.CollectConf{DedupMaxKeys: 1},
+			lines:     []line{{"a", "x"}, {"a", "x"}, {"a", "y"}, {"a", "x"}},
+			forwarded: []bool{true, false, true, true},
+			summaries: []summary{{"a", "x", 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.DedupWindow = "1h"
+			d, err := newDeduper(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &collector{}
+			d.SetEmit(c.emit)
+			for i, l := range tt.lines {
+				ok := d.Process(&module.TextMsg{Msg: l.text, Source: l.source})
+				if ok != tt.forwarded[i] {
+					t.Errorf("line %d %q forwarded = %v, want %v", i, l.text, ok, tt.forwarded[i])
+				}
+			}
+			d.Close()
+
+			got := c.list()
+			if len(got) != len(tt.summaries) {
+				t.Fatalf("got %d summaries, want %d", len(got), len(tt.summaries))
+			}
+			for i, want := range tt.summaries {
+				msg := got[i]
+				if msg.Source != want.source || msg.Msg != want.text || msg.Fields["repeat_count"] != want.count {
+					t.Errorf("summary %d = %s %q %v, want %s %q %d", i, msg.Source, msg.Msg,
+						msg.Fields["repeat_count"], want.source, want.text, want.count)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupWindowExpire(t *testing.T) {
+	d, err := newDeduper(module.CollectConf{DedupWindow: "50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	d.SetEmit(c.emit)
+	defer d.Close()
+
+	d.Process(&module.TextMsg{Msg: "x"})
+	d.Process(&module.TextMsg{Msg: "x"})
+	for i := 0; i < 50 && len(c.list()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := c.list(); len(got) != 1 || got[0].Fields["repeat_count"] != 1 {
+		t.Fatalf("expect one summary after window, got %v", got)
+	}
+	//窗口结束后同样的行重新开始计算
+	if !d.Process(&module.TextMsg{Msg: "x"}) {
+		t.Error("line after window should be forwarded")
+	}
+}
+
+//TestDedupAck 缓存的重复行在汇总发出之后才确认
+func TestDedupAck(t *testing.T) {
+	d, err := newDeduper(module.CollectConf{DedupWindow: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	d.SetEmit(c.emit)
+
+	acked := make([]bool, 3)
+	for i := range acked {
+		i := i
+		ack := module.NewAck(func() { acked[i] = true })
+		d.Process(&module.TextMsg{Msg: "x", Ack: ack})
+		ack.Done()
+	}
+	if !acked[0] || acked[1] || !acked[2] {
+		t.Fatalf("acked = %v, want only the held line pending", acked)
+	}
+	d.Close()
+	if len(c.list()) != 1 || !acked[1] {
+		t.Errorf("acked = %v after summary emitted", acked)
+	}
+}
+
+//TestDedupMemoryFull 超出内存上限时不缓存也不阻塞,直接放行
+func TestDedupMemoryFull(t *testing.T) {
+	memory.Acquire(100)
+	memory.SetLimit(100)
+	defer func() {
+		memory.SetLimit(0)
+		memory.Release(100)
+	}()
+
+	d, err := newDeduper(module.CollectConf{DedupWindow: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	d.SetEmit(c.emit)
+	for i := 0; i < 3; i++ {
+		if !d.Process(&module.TextMsg{Msg: "x"}) {
+			t.Errorf("line %d should be forwarded when memory is full", i)
+		}
+	}
+	d.Close()
+	if n := len(c.list()); n != 0 {
+		t.Errorf("got %d summaries, want 0", n)
+	}
+}
+
+func TestChainDedup(t *testing.T) {
+	var lk sync.Mutex
+	var out []string
+	chain, err := New(module.CollectConf{Dedup: true, DedupWindow: "1h"}, func(msg *module.TextMsg) {
+		lk.Lock()
+		out = append(out, msg.Value())
+		lk.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a", "b", "a", "a", "c"} {
+		chain.Process(&module.TextMsg{Msg: line})
+	}
+	chain.Close()
+
+	want := []string{"a", "b", "c"}
+	if len(out) != 4 {
+		t.Fatalf("got %v, want %v and a summary", out, want)
+	}
+	for i, w := range want {
+		if out[i] != w {
+			t.Errorf("line %d = %q, want %q", i, out[i], w)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package process
+
+import (
+	"fmt"
+	"logagent/metrics"
+	"logagent/module"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const (
+	invalidReplace = "replace"
+	invalidDrop    = "drop"
+)
+
+//newCharsetDecoder 根据encoding配置生成转码processor,utf-8或者为空时返回nil
+func newCharsetDecoder(conf module.CollectConf) (Processor, error) {
+	invalid := conf.EncodingInvalid
+	switch invalid {
+	case "":
+		invalid = invalidReplace
+	case invalidReplace, invalidDrop:
+	default:
+		return nil, fmt.Errorf("invalid encoding_invalid:%s", invalid)
+	}
+
+	name := strings.ToLower(strings.TrimSpace(conf.Encoding))
+	var enc encoding.Encoding
+	switch name {
+	case "", "utf-8", "utf8":
+		if invalid == invalidReplace && len(name) == 0 {
+			return nil, nil
+		}
+		return &utf8Validator{task: conf.Name, drop: invalid == invalidDrop}, nil
+	case "gbk", "gb2312", "cp936":
+		enc = simplifiedchinese.GBK
+	case "gb18030":
+		enc = simplifiedchinese.GB18030
+	case "hz-gb-2312", "hz-gb2312":
+		enc = simplifiedchinese.HZGB2312
+	case "latin1", "iso-8859-1":
+		return &latin1Decoder{}, nil
+	case "utf-16", "utf16", "utf-16le", "utf16le":
+		return newUTF16Decoder(conf.Name, false, name == "utf-16" || name == "utf16", invalid == invalidDrop), nil
+	case "utf-16be", "utf16be":
+		return newUTF16Decoder(conf.Name, true, false, invalid == invalidDrop), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding:%s", conf.Encoding)
+	}
+	return &charsetDecoder{task: conf.Name, enc: enc, drop: invalid == invalidDrop}, nil
+}
+
+func decodeError(task string) {
+	metrics.Inc("encoding."+task+".decode_errors", 1)
+}
+
+//utf8Validator 处理utf-8中的非法字节
+type utf8Validator struct {
+	task string
+	drop bool
+}
+
+func (v *utf8Validator) Process(msg *module.TextMsg) bool {
+	if utf8.ValidString(msg.Msg) {
+		return true
+	}
+	decodeError(v.task)
+	if v.drop {
+		return false
+	}
+	msg.SetMsg(strings.ToValidUTF8(msg.Msg, "�"))
+	return true
+}
+
+//latin1Decoder 每个字节对应一个unicode字符,不会出错
+type latin1Decoder struct{}
+
+func (d *latin1Decoder) Process(msg *module.TextMsg) bool {
+	runes := make([]rune, len(msg.Msg))
+	for i := 0; i < len(msg.Msg); i++ {
+		runes[i] = rune(msg.Msg[i])
+	}
+	msg.SetMsg(string(runes))
+	return true
+}
+
+//charsetDecoder GBK一类的编码,换行符不会出现在多字节字符中,可以逐行转换
+type charsetDecoder struct {
+	task string
+	enc  encoding.Encoding
+	drop bool
+}
+
+func (d *charsetDecoder) Process(msg *module.TextMsg) bool {
+	text, err := d.enc.NewDecoder().String(msg.Msg)
+	//非法的字节会被替换成U+FFFD
+	if err != nil || strings.ContainsRune(text, utf8.RuneError) {
+		decodeError(d.task)
+		if d.drop {
+			return false
+		}
+		if err != nil {
+			text = strings.ToValidUTF8(msg.Msg, "�")
+		}
+	}
+	msg.SetMsg(text)
+	return true
+}
+
+//IsUTF16 encoding是否为utf-16,读取文件时需要按两个字节对齐的换行切分行
+func IsUTF16(encoding string) bool {
+	name := strings.ToLower(strings.TrimSpace(encoding))
+	return strings.HasPrefix(name, "utf-16") || strings.HasPrefix(name, "utf16")
+}
+
+//utf16Decoder 读取时已经按对齐的换行切分,每行单独解码,
+//detectBOM时按每个来源开头的BOM确定字节序,没有BOM时按小端
+type utf16Decoder struct {
+	task      string
+	bigEndian bool
+	detectBOM bool
+	drop      bool
+	//从BOM识别出的每个来源的字节序
+	sources map[string]bool
+}
+
+func newUTF16Decoder(task string, bigEndian, detectBOM, drop bool) *utf16Decoder {
+	return &utf16Decoder{task: task, bigEndian: bigEndian, detectBOM: detectBOM, drop: drop,
+		sources: make(map[string]bool)}
+}
+
+func (d *utf16Decoder) Process(msg *module.TextMsg) bool {
+	line := msg.Msg
+	bigEndian := d.bigEndian
+	if d.detectBOM {
+		if be, ok := d.sources[msg.Source]; ok {
+			bigEndian = be
+		}
+		if len(line) >= 2 {
+			switch {
+			case line[0] == 0xFF && line[1] == 0xFE:
+				bigEndian = false
+				d.sources[msg.Source] = false
+				line = line[2:]
+			case line[0] == 0xFE && line[1] == 0xFF:
+				bigEndian = true
+				d.sources[msg.Source] = true
+				line = line[2:]
+			}
+		}
+	}
+
+	units := make([]uint16, 0, len(line)/2)
+	for i := 0; i+1 < len(line); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(line[i])<<8|uint16(line[i+1]))
+		} else {
+			units = append(units, uint16(line[i+1])<<8|uint16(line[i]))
+		}
+	}
+	//没有识别BOM时,文件开头的BOM解码后是U+FEFF
+	if len(units) > 0 && units[0] == 0xFEFF {
+		units = units[1:]
+	}
+	if n := len(units); n > 0 && units[n-1] == '\r' {
+		units = units[:n-1]
+	}
+
+	runes := utf16.Decode(units)
+	//剩下的单个字节不是完整的字符
+	if len(line)%2 == 1 {
+		runes = append(runes, utf8.RuneError)
+	}
+	for _, r := range runes {
+		if r == utf8.RuneError {
+			decodeError(d.task)
+			if d.drop {
+				return false
+			}
+			break
+		}
+	}
+	msg.SetMsg(string(runes))
+	return true
+}
@@ -0,0 +1,106 @@
+package process
+
+import (
+	"logagent/module"
+	"testing"
+	"unicode/utf16"
+)
+
+//encodeUTF16 测试用,把字符串编码成utf-16字节
+func encodeUTF16(s string, bigEndian bool) string {
+	var buf []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			buf = append(buf, byte(u>>8), byte(u))
+		} else {
+			buf = append(buf, byte(u), byte(u>>8))
+		}
+	}
+	return string(buf)
+}
+
+func TestCharsetDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		invalid  string
+		line     string
+		want     string
+		keep     bool
+	}{
+		{"gbk", "gbk", "", "\xc4\xe3\xba\xc3", "你好", true},
+		{"gb18030", "GB18030", "", "\xc4\xe3\xba\xc3", "你好", true},
+		{"latin1", "latin1", "", "caf\xe9", "café", true},
+		{"utf-8 replace", "utf-8", "replace", "a\xffb", "a�b", true},
+		{"utf-8 drop", "utf-8", "drop", "a\xffb", "", false},
+		{"utf-16le", "utf-16le", "", encodeUTF16("上午\r", false), "上午", true},
+		{"utf-16be", "utf-16be", "", encodeUTF16("上午", true), "上午", true},
+		{"utf-16le bom stripped", "utf-16le", "", encodeUTF16("\ufeffabc", false), "abc", true},
+		{"utf-16 bom big endian", "utf-16", "", encodeUTF16("\ufeffabc", true), "abc", true},
+		{"utf-16 no bom little endian", "utf-16", "", encodeUTF16("abc", false), "abc", true},
+		{"utf-16 odd byte replace", "utf-16le", "", encodeUTF16("ab", false) + "c", "ab�", true},
+		{"utf-16 odd byte drop", "utf-16le", "drop", encodeUTF16("ab", false) + "c", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newCharsetDecoder(module.CollectConf{Encoding: tt.encoding, EncodingInvalid: tt.invalid})
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := &module.TextMsg{Msg: tt.line}
+			keep := p.Process(msg)
+			if keep != tt.keep {
+				t.Fatalf("Process = %v, want %v", keep, tt.keep)
+			}
+			if keep && msg.Msg != tt.want {
+				t.Errorf("decoded %q, want %q", msg.Msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestCharsetDecoderConfig(t *testing.T) {
+	if p, err := newCharsetDecoder(module.CollectConf{}); p != nil || err != nil {
+		t.Errorf("default encoding should not add a processor, got %v %v", p, err)
+	}
+	for _, conf := range []module.CollectConf{
+		{Encoding: "ebcdic"},
+		{Encoding: "gbk", EncodingInvalid: "ignore"},
+	} {
+		if _, err := newCharsetDecoder(conf); err == nil {
+			t.Errorf("expect error for %+v", conf)
+		}
+	}
+}
+
+//TestUTF16BOMPerSource 每个来源按自己开头的BOM确定字节序
+func TestUTF16BOMPerSource(t *testing.T) {
+	d := newUTF16Decoder("t", false, true, false)
+	lines := []struct {
+		source string
+		line   string
+		want   string
+	}{
+		{"be.log", encodeUTF16("\ufeffbig", true), "big"},
+		{"le.log", encodeUTF16("\ufefflittle", false), "little"},
+		{"be.log", encodeUTF16("上午", true), "上午"},
+		{"le.log", encodeUTF16("上午", false), "上午"},
+		{"other.log", encodeUTF16("x", false), "x"},
+	}
+	for _, l := range lines {
+		msg := &module.TextMsg{Msg: l.line, Source: l.source}
+		if !d.Process(msg) || msg.Msg != l.want {
+			t.Errorf("%s: decoded %q, want %q", l.source, msg.Msg, l.want)
+		}
+	}
+}
+
+func TestIsUTF16(t *testing.T) {
+	for name, want := range map[string]bool{
+		"utf-16": true, "UTF-16LE": true, "utf16be": true, "utf-8": false, "gbk": false, "": false,
+	} {
+		if got := IsUTF16(name); got != want {
+			t.Errorf("IsUTF16(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
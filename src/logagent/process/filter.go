@@ -0,0 +1,158 @@
+package process
+
+import (
+	"fmt"
+	"logagent/metrics"
+	"logagent/module"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//日志级别,数字越大越严重
+var levelRanks = map[string]int{
+	"trace":     10,
+	"debug":     20,
+	"info":      30,
+	"notice":    35,
+	"warn":      40,
+	"warning":   40,
+	"error":     50,
+	"err":       50,
+	"crit":      60,
+	"critical":  60,
+	"fatal":     60,
+	"panic":     60,
+	"alert":     70,
+	"emerg":     80,
+	"emergency": 80,
+}
+
+//levelRank 解析级别名称,也支持单字母和bunyan/pino的数字级别
+func levelRank(level string) (int, bool) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if rank, ok := levelRanks[level]; ok {
+		return rank, true
+	}
+	if len(level) == 1 {
+		switch level {
+		case "t":
+			return levelRanks["trace"], true
+		case "d":
+			return levelRanks["debug"], true
+		case "i":
+			return levelRanks["info"], true
+		case "w":
+			return levelRanks["warn"], true
+		case "e":
+			return levelRanks["error"], true
+		case "f":
+			return levelRanks["fatal"], true
+		}
+	}
+	if n, err := strconv.Atoi(level); err == nil && n >= 10 {
+		return n, true
+	}
+	return 0, false
+}
+
+func compileRegexps(name string, exprs []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, expr := range exprs {
+		if len(expr) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s regexp %q:%v", name, expr, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+//lineFilter 按正则过滤原始行
+type lineFilter struct {
+	task    string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newLineFilter(conf module.CollectConf) (*lineFilter, error) {
+	f := &lineFilter{task: conf.Name}
+	var err error
+	if f.include, err = compileRegexps("include", conf.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileRegexps("exclude", conf.Exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *lineFilter) Process(msg *module.TextMsg) bool {
+	if len(f.include) > 0 && !matchAny(f.include, msg.Msg) {
+		dropped(f.task, "include")
+		return false
+	}
+	if matchAny(f.exclude, msg.Msg) {
+		dropped(f.task, "exclude")
+		return false
+	}
+	return true
+}
+
+func matchAny(res []*regexp.Regexp, line string) bool {
+	for _, re := range res {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+//levelFilter 丢弃低于min_level的消息,没有级别字段或无法识别的级别会保留
+type levelFilter struct {
+	task  string
+	field string
+	min   int
+}
+
+func newLevelFilter(conf module.CollectConf) (*levelFilter, error) {
+	min, ok := levelRank(conf.MinLevel)
+	if !ok {
+		return nil, fmt.Errorf("invalid min_level:%s", conf.MinLevel)
+	}
+	f := &levelFilter{task: conf.Name, field: conf.LevelField, min: min}
+	if len(f.field) == 0 {
+		f.field = defaultLevelField(conf.Input)
+	}
+	return f, nil
+}
+
+func (f *levelFilter) Process(msg *module.TextMsg) bool {
+	v, ok := msg.Fields[f.field]
+	if !ok {
+		return true
+	}
+	rank, ok := levelRank(fmt.Sprint(v))
+	if ok && rank < f.min {
+		dropped(f.task, "level")
+		return false
+	}
+	return true
+}
+
+//defaultLevelField syslog和journal的级别在severity字段中,其他输入默认为level
+func defaultLevelField(input string) string {
+	switch input {
+	case "syslog", "journal":
+		return "severity"
+	}
+	return "level"
+}
+
+//dropped 按任务和原因统计丢弃数量
+func dropped(task, reason string) {
+	metrics.Inc("filter."+task+".dropped."+reason, 1)
+}
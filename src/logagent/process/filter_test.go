@@ -0,0 +1,66 @@
+package process
+
+import (
+	"encoding/json"
+	"logagent/module"
+	"testing"
+)
+
+func TestLineFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		line    string
+		keep    bool
+	}{
+		{"include match", []string{"ERROR", "WARN"}, nil, "ERROR disk full", true},
+		{"include miss", []string{"ERROR"}, nil, "INFO ok", false},
+		{"exclude match", nil, []string{"healthcheck"}, "GET /healthcheck", false},
+		{"exclude wins", []string{"GET"}, []string{"healthcheck"}, "GET /healthcheck", false},
+		{"no match exclude", nil, []string{"healthcheck"}, "GET /api", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newLineFilter(module.CollectConf{Include: tt.include, Exclude: tt.exclude})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keep := f.Process(&module.TextMsg{Msg: tt.line}); keep != tt.keep {
+				t.Errorf("Process(%q) = %v, want %v", tt.line, keep, tt.keep)
+			}
+		})
+	}
+}
+
+func TestLevelFilter(t *testing.T) {
+	f, err := newLevelFilter(module.CollectConf{MinLevel: "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		level interface{}
+		keep  bool
+	}{
+		{"debug", false},
+		{"INFO", false},
+		{"warning", true},
+		{"E", true},
+		{json.Number("30"), false},
+		{json.Number("50"), true},
+		{"custom", true},
+		{nil, true},
+	}
+	for _, tt := range tests {
+		msg := &module.TextMsg{Msg: "x"}
+		if tt.level != nil {
+			msg.SetField("level", tt.level)
+		}
+		if keep := f.Process(msg); keep != tt.keep {
+			t.Errorf("level %v: keep = %v, want %v", tt.level, keep, tt.keep)
+		}
+	}
+	if _, err := newLevelFilter(module.CollectConf{MinLevel: "loud"}); err == nil {
+		t.Error("expected error for unknown min_level")
+	}
+}
@@ -0,0 +1,45 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+//decodeJSON 解析一行json对象,flatten为true时把嵌套对象展开成a.b.c形式的key
+func decodeJSON(line string, flatten bool, sep string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("json: not an object")
+	}
+	if dec.More() {
+		return nil, errors.New("json: trailing data after object")
+	}
+
+	if !flatten {
+		return fields, nil
+	}
+	flat := make(map[string]interface{}, len(fields))
+	flattenInto(flat, "", fields, sep)
+	return flat, nil
+}
+
+func flattenInto(dst map[string]interface{}, prefix string, src map[string]interface{}, sep string) {
+	for k, v := range src {
+		key := k
+		if len(prefix) > 0 {
+			key = prefix + sep + k
+		}
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+			flattenInto(dst, key, sub, sep)
+			continue
+		}
+		dst[key] = v
+	}
+}
@@ -0,0 +1,102 @@
+package process
+
+import (
+	"encoding/json"
+	"logagent/module"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		flatten bool
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{"object", `{"a":"x","n":1}`, false, map[string]interface{}{"a": "x", "n": json.Number("1")}, false},
+		{"nested", `{"a":{"b":"c"}}`, false, map[string]interface{}{"a": map[string]interface{}{"b": "c"}}, false},
+		{"flatten", `{"a":{"b":{"c":true}},"d":{}}`, true, map[string]interface{}{"a.b.c": true, "d": map[string]interface{}{}}, false},
+		{"not object", `[1,2]`, false, nil, true},
+		{"null", `null`, false, nil, true},
+		{"trailing", `{"a":1} {"b":2}`, false, nil, true},
+		{"plain text", `hello`, false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeJSON(tt.line, tt.flatten, ".")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeJSON(%q) err = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeJSON(%q) = %#v, want %#v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoderOnError(t *testing.T) {
+	tests := []struct {
+		onError string
+		keep    bool
+		fields  map[string]interface{}
+	}{
+		{onErrorPass, true, nil},
+		{onErrorTag, true, map[string]interface{}{"message": "oops", "tags": []string{"_jsonparsefailure"}}},
+		{onErrorDrop, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.onError, func(t *testing.T) {
+			d, err := newDecoder(module.CollectConf{Decoder: "json", DecodeOnError: tt.onError})
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := &module.TextMsg{Msg: "oops"}
+			if keep := d.Process(msg); keep != tt.keep {
+				t.Errorf("Process keep = %v, want %v", keep, tt.keep)
+			}
+			if !reflect.DeepEqual(msg.Fields, tt.fields) {
+				t.Errorf("fields = %#v, want %#v", msg.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestDecoderKeepsExistingFields(t *testing.T) {
+	tests := []struct {
+		name string
+		conf module.CollectConf
+		line string
+		want map[string]interface{}
+	}{
+		{
+			"decoded",
+			module.CollectConf{Decoder: "json", DecodeKeepRaw: true, DecodeRawField: "raw"},
+			`{"a":"x"}`,
+			map[string]interface{}{"a": "x", "facility": "daemon", "tags": []string{"syslog"}, "raw": `{"a":"x"}`},
+		},
+		{
+			//解析失败时也保留已有字段,tags追加在原来的后面
+			"on_error tag",
+			module.CollectConf{Decoder: "json", DecodeOnError: onErrorTag, DecodeRawField: "raw"},
+			`{"a":`,
+			map[string]interface{}{"message": `{"a":`, "facility": "daemon", "tags": []string{"syslog", "_jsonparsefailure"}, "raw": `{"a":`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDecoder(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := &module.TextMsg{Msg: tt.line}
+			msg.SetField("facility", "daemon")
+			msg.SetField("tags", []string{"syslog"})
+			d.Process(msg)
+			if !reflect.DeepEqual(msg.Fields, tt.want) {
+				t.Errorf("fields = %#v, want %#v", msg.Fields, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+//decodeLogfmt 解析key=value形式的日志,value可以用双引号包起来
+func decodeLogfmt(line string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	hasPair := false
+
+	i := 0
+	for i < len(line) {
+		//跳过空白
+		for i < len(line) && isLogfmtSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && !isLogfmtSpace(line[i]) {
+			if line[i] == '"' {
+				return nil, fmt.Errorf("logfmt: unexpected quote in key at %d", i)
+			}
+			i++
+		}
+		key := line[start:i]
+		if len(key) == 0 {
+			return nil, fmt.Errorf("logfmt: empty key at %d", i)
+		}
+
+		//只有key没有value
+		if i >= len(line) || line[i] != '=' {
+			fields[key] = ""
+			continue
+		}
+		i++
+		hasPair = true
+
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, errors.New("logfmt: unterminated quoted value")
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("logfmt: bad quoted value for %s: %v", key, err)
+			}
+			fields[key] = value
+			i = end + 1
+			continue
+		}
+
+		start = i
+		for i < len(line) && !isLogfmtSpace(line[i]) {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+
+	if !hasPair {
+		return nil, errors.New("logfmt: no key=value pair found")
+	}
+	return fields, nil
+}
+
+func isLogfmtSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
@@ -0,0 +1,35 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeLogfmt(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{`level=info msg=started`, map[string]interface{}{"level": "info", "msg": "started"}, false},
+		{`msg="hello world" code=200`, map[string]interface{}{"msg": "hello world", "code": "200"}, false},
+		{`msg="say \"hi\"" x=`, map[string]interface{}{"msg": `say "hi"`, "x": ""}, false},
+		{"a=1\tdebug", map[string]interface{}{"a": "1", "debug": ""}, false},
+		{`  a=1  `, map[string]interface{}{"a": "1"}, false},
+		{`just some text`, nil, true},
+		{`msg="unterminated`, nil, true},
+		{`=value`, nil, true},
+		{`"key"=v`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := decodeLogfmt(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeLogfmt(%q) err = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeLogfmt(%q) = %#v, want %#v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package process
+
+import (
+	"fmt"
+	"logagent/module"
+	"sync"
+)
+
+//Processor 对一条消息进行加工,返回false表示丢弃该消息
+type Processor interface {
+	Process(msg *module.TextMsg) bool
+}
+
+//Emitter 会缓存消息并在之后发出的processor,比如合并重复行
+type Emitter interface {
+	Processor
+	//SetEmit 设置缓存的消息之后的去处
+	SetEmit(emit func(msg *module.TextMsg))
+	//Close 发出所有缓存的消息
+	Close()
+}
+
+//asyncEmitter 在自己的协程中发出缓存消息的Emitter,emit会先加处理链的锁,
+//所以只能在Process之外调用
+type asyncEmitter interface {
+	Emitter
+	emitAsync()
+}
+
+//Chain 按顺序执行的一组processor,通过处理的消息交给out
+//同步处理和缓存消息的发出都在lk下执行,processor不会被并发调用
+type Chain struct {
+	lk    sync.Mutex
+	procs []Processor
+	out   func(msg *module.TextMsg)
+}
+
+//New 根据收集配置生成处理链
+func New(conf module.CollectConf, out func(msg *module.TextMsg)) (*Chain, error) {
+	chain := &Chain{out: out}
+	//先转成utf-8再做其他处理
+	dec, err := newCharsetDecoder(conf)
+	if err != nil {
+		return nil, err
+	}
+	if dec != nil {
+		chain.procs = append(chain.procs, dec)
+	}
+	if len(conf.Include) > 0 || len(conf.Exclude) > 0 {
+		filter, err := newLineFilter(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, filter)
+	}
+	if len(conf.Decoder) > 0 {
+		dec, err := newDecoder(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, dec)
+	}
+	if len(conf.TimestampField) > 0 || len(conf.TimestampRegex) > 0 {
+		ts, err := newTimestamper(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, ts)
+	}
+	if len(conf.MinLevel) > 0 {
+		filter, err := newLevelFilter(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, filter)
+	}
+	if conf.Dedup {
+		dedup, err := newDeduper(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, dedup)
+	}
+	if (conf.SampleRate != nil && *conf.SampleRate < 1) || len(conf.SampleRules) > 0 {
+		sample, err := newSampler(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, sample)
+	}
+	if conf.RateLines > 0 || conf.RateBytes > 0 {
+		limit, err := newLimiter(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, limit)
+	}
+	if len(conf.TopicRoutes) > 0 {
+		r, err := newRouter(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, r)
+	}
+	//脱敏放在解码之后,解析出的字段也会被处理
+	if len(conf.Redact) > 0 || len(conf.RedactPatterns) > 0 {
+		r, err := newRedactor(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, r)
+	}
+	//长度限制放在脱敏之后,拆开的行不会漏掉跨段的敏感信息,解码器也能拿到完整的json
+	if conf.MaxLineBytes > 0 {
+		t, err := newTruncater(conf)
+		if err != nil {
+			return nil, err
+		}
+		chain.procs = append(chain.procs, t)
+	}
+
+	//缓存的消息从下一个processor继续执行
+	for i, p := range chain.procs {
+		if e, ok := p.(Emitter); ok {
+			next := i + 1
+			if _, ok := e.(asyncEmitter); ok {
+				e.SetEmit(func(msg *module.TextMsg) {
+					chain.lk.Lock()
+					defer chain.lk.Unlock()
+					chain.run(msg, next)
+				})
+				continue
+			}
+			e.SetEmit(func(msg *module.TextMsg) {
+				chain.run(msg, next)
+			})
+		}
+	}
+	return chain, nil
+}
+
+//Process 依次执行处理链,没有被丢弃的消息交给out
+func (c *Chain) Process(msg *module.TextMsg) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.run(msg, 0)
+}
+
+func (c *Chain) run(msg *module.TextMsg, from int) {
+	for _, p := range c.procs[from:] {
+		if !p.Process(msg) {
+			return
+		}
+	}
+	c.out(msg)
+}
+
+//Close 发出所有processor中缓存的消息
+func (c *Chain) Close() {
+	for _, p := range c.procs {
+		if e, ok := p.(Emitter); ok {
+			e.Close()
+		}
+	}
+}
+
+const (
+	onErrorPass = "pass"
+	onErrorTag  = "tag"
+	onErrorDrop = "drop"
+)
+
+//decoder 把一行日志解析成字段
+type decoder struct {
+	name    string
+	decode  func(line string) (map[string]interface{}, error)
+	keepRaw bool
+	rawKey  string
+	onError string
+}
+
+func newDecoder(conf module.CollectConf) (*decoder, error) {
+	d := &decoder{
+		name:    conf.Decoder,
+		keepRaw: conf.DecodeKeepRaw,
+		rawKey:  conf.DecodeRawField,
+		onError: conf.DecodeOnError,
+	}
+	if len(d.rawKey) == 0 {
+		d.rawKey = "message"
+	}
+	if len(d.onError) == 0 {
+		d.onError = onErrorPass
+	}
+	switch d.onError {
+	case onErrorPass, onErrorTag, onErrorDrop:
+	default:
+		return nil, fmt.Errorf("invalid decode_on_error:%s", d.onError)
+	}
+
+	switch d.name {
+	case "json":
+		sep := conf.DecodeSep
+		if len(sep) == 0 {
+			sep = "."
+		}
+		flatten := conf.DecodeFlatten
+		d.decode = func(line string) (map[string]interface{}, error) {
+			return decodeJSON(line, flatten, sep)
+		}
+	case "logfmt":
+		d.decode = decodeLogfmt
+	default:
+		return nil, fmt.Errorf("invalid decoder:%s", d.name)
+	}
+	return d, nil
+}
+
+func (d *decoder) Process(msg *module.TextMsg) bool {
+	fields, err := d.decode(msg.Msg)
+	if err != nil {
+		switch d.onError {
+		case onErrorDrop:
+			return false
+		case onErrorTag:
+			//和解析成功时一样保留已有的字段
+			if msg.Fields == nil {
+				msg.Fields = make(map[string]interface{})
+			}
+			tags, _ := msg.Fields["tags"].([]string)
+			msg.Fields[d.rawKey] = msg.Msg
+			msg.Fields["tags"] = append(tags, "_"+d.name+"parsefailure")
+		}
+		return true
+	}
+
+	//保留解码前已有的字段,比如syslog的facility
+	for k, v := range msg.Fields {
+		if _, ok := fields[k]; !ok && k != "message" {
+			fields[k] = v
+		}
+	}
+	if d.keepRaw {
+		fields[d.rawKey] = msg.Msg
+	}
+	msg.Fields = fields
+	return true
+}
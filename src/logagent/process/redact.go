@@ -0,0 +1,267 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"logagent/metrics"
+	"logagent/module"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//detector 一类敏感信息,group为需要替换的分组,0表示整个匹配
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	group int
+	valid func(string) bool
+}
+
+//内置的检测规则,按顺序执行,身份证要在银行卡之前
+var builtinDetectors = map[string]*detector{
+	"bearer": {
+		name:  "bearer",
+		re:    regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+		group: 1,
+	},
+	"email": {
+		name: "email",
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	"idcard": {
+		name:  "idcard",
+		re:    regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+		valid: validIDCard,
+	},
+	"card": {
+		name:  "card",
+		re:    regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		valid: validLuhn,
+	},
+	"phone": {
+		name: "phone",
+		re:   regexp.MustCompile(`(?:\+?86[\- ]?)?\b1[3-9]\d{9}\b`),
+	},
+}
+
+var builtinOrder = []string{"bearer", "email", "idcard", "card", "phone"}
+
+const (
+	redactMask    = "mask"
+	redactPartial = "partial"
+	redactHash    = "hash"
+)
+
+//redactor 在发送前替换掉敏感信息
+type redactor struct {
+	task      string
+	detectors []*detector
+	strategy  string
+	keepLast  int
+	salt      string
+}
+
+func newRedactor(conf module.CollectConf) (*redactor, error) {
+	r := &redactor{
+		task:     conf.Name,
+		strategy: conf.RedactStrategy,
+		keepLast: conf.RedactKeepLast,
+		salt:     conf.RedactSalt,
+	}
+	if len(r.strategy) == 0 {
+		r.strategy = redactMask
+	}
+	switch r.strategy {
+	case redactMask, redactHash:
+	case redactPartial:
+		if r.keepLast <= 0 {
+			r.keepLast = 4
+		}
+	default:
+		return nil, fmt.Errorf("invalid redact_strategy:%s", r.strategy)
+	}
+
+	enabled := make(map[string]bool)
+	for _, name := range conf.Redact {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if name == "all" {
+			for _, n := range builtinOrder {
+				enabled[n] = true
+			}
+			continue
+		}
+		if _, ok := builtinDetectors[name]; !ok {
+			return nil, fmt.Errorf("unknown redact detector:%s", name)
+		}
+		enabled[name] = true
+	}
+	for _, name := range builtinOrder {
+		if enabled[name] {
+			r.detectors = append(r.detectors, builtinDetectors[name])
+		}
+	}
+
+	custom, err := compileRegexps("redact_patterns", conf.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+	for i, re := range custom {
+		d := &detector{name: fmt.Sprintf("custom%d", i), re: re}
+		//有分组时只替换第一个分组
+		if re.NumSubexp() > 0 {
+			d.group = 1
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	return r, nil
+}
+
+func (r *redactor) Process(msg *module.TextMsg) bool {
+	msg.Msg = r.redact(msg.Msg)
+	for k, v := range msg.Fields {
+		msg.Fields[k] = r.redactValue(v)
+	}
+	return true
+}
+
+//redactValue 处理解析出的各种字段值,容器标签和structured_data等带类型的map复制后再修改,
+//避免改到缓存中共享的元数据
+func (r *redactor) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return r.redact(val)
+	case json.Number:
+		//json解码使用UseNumber,手机号和卡号可能是数字
+		if s := r.redact(val.String()); s != val.String() {
+			return s
+		}
+		return val
+	case float64:
+		str := strconv.FormatFloat(val, 'f', -1, 64)
+		if s := r.redact(str); s != str {
+			return s
+		}
+		return val
+	case int64:
+		str := strconv.FormatInt(val, 10)
+		if s := r.redact(str); s != str {
+			return s
+		}
+		return val
+	case map[string]interface{}:
+		for k, sub := range val {
+			val[k] = r.redactValue(sub)
+		}
+		return val
+	case []interface{}:
+		for i, sub := range val {
+			val[i] = r.redactValue(sub)
+		}
+		return val
+	case []string:
+		out := make([]string, len(val))
+		for i, sub := range val {
+			out[i] = r.redact(sub)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(val))
+		for k, sub := range val {
+			out[k] = r.redact(sub)
+		}
+		return out
+	case map[string]map[string]string:
+		out := make(map[string]map[string]string, len(val))
+		for k, sub := range val {
+			out[k] = r.redactValue(sub).(map[string]string)
+		}
+		return out
+	}
+	return v
+}
+
+func (r *redactor) redact(s string) string {
+	for _, d := range r.detectors {
+		s = r.replace(d, s)
+	}
+	return s
+}
+
+func (r *redactor) replace(d *detector, s string) string {
+	matches := d.re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*d.group], m[2*d.group+1]
+		if start < 0 {
+			continue
+		}
+		value := s[start:end]
+		if d.valid != nil && !d.valid(value) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.mask(value))
+		last = end
+		metrics.Inc("redact."+r.task+"."+d.name, 1)
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func (r *redactor) mask(value string) string {
+	switch r.strategy {
+	case redactHash:
+		//加盐哈希,相同的值得到相同结果,方便下游关联
+		sum := sha256.Sum256([]byte(r.salt + value))
+		return "[hash:" + hex.EncodeToString(sum[:8]) + "]"
+	case redactPartial:
+		if len(value) <= r.keepLast {
+			return strings.Repeat("*", len(value))
+		}
+		return strings.Repeat("*", len(value)-r.keepLast) + value[len(value)-r.keepLast:]
+	}
+	return strings.Repeat("*", len(value))
+}
+
+//validLuhn 银行卡号校验
+func validLuhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+//validIDCard 18位身份证校验码
+func validIDCard(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	codes := "10X98765432"
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+	return codes[sum%11] == strings.ToUpper(s[17:])[0]
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"encoding/json"
+	"logagent/module"
+	"reflect"
+	"testing"
+)
+
+func TestRedactText(t *testing.T) {
+	tests := []struct {
+		name     string
+		redact   []string
+		patterns []string
+		strategy string
+		in       string
+		want     string
+	}{
+		{"phone", []string{"phone"}, nil, "mask", "call 13812345678 now", "call *********** now"},
+		{"email", []string{"email"}, nil, "mask", "to a@b.com", "to *******"},
+		{"card luhn", []string{"card"}, nil, "partial", "card 4111111111111111", "card ************1111"},
+		{"card invalid luhn", []string{"card"}, nil, "mask", "id 4111111111111112", "id 4111111111111112"},
+		{"bearer", []string{"bearer"}, nil, "mask", "Authorization: Bearer abc.def", "Authorization: Bearer *******"},
+		{"idcard", []string{"idcard"}, nil, "mask", "id 11010519491231002X", "id ******************"},
+		{"custom group", nil, []string{`password=(\S+)`}, "mask", "password=secret x", "password=****** x"},
+		{"hash", []string{"email"}, nil, "hash", "a@b.com", "[hash:fb98d44ad7501a95]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newRedactor(module.CollectConf{Redact: tt.redact, RedactPatterns: tt.patterns, RedactStrategy: tt.strategy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.redact(tt.in); got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactValueTypes(t *testing.T) {
+	r, err := newRedactor(module.CollectConf{Redact: []string{"all"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"owner": "a@b.com", "app": "web"}
+	tests := []struct {
+		name string
+		in   interface{}
+		want interface{}
+	}{
+		{"string", "a@b.com", "*******"},
+		{"json.Number phone", json.Number("13812345678"), "***********"},
+		{"json.Number card", json.Number("4111111111111111"), "****************"},
+		{"json.Number plain", json.Number("200"), json.Number("200")},
+		{"float64 phone", float64(13812345678), "***********"},
+		{"int64 phone", int64(13812345678), "***********"},
+		{"nested map", map[string]interface{}{"phone": json.Number("13812345678")}, map[string]interface{}{"phone": "***********"}},
+		{"slice", []interface{}{"a@b.com", json.Number("1")}, []interface{}{"*******", json.Number("1")}},
+		{"string slice", []string{"a@b.com"}, []string{"*******"}},
+		{"labels", labels, map[string]string{"owner": "*******", "app": "web"}},
+		{"structured data", map[string]map[string]string{"meta@1": {"mail": "a@b.com"}},
+			map[string]map[string]string{"meta@1": {"mail": "*******"}}},
+		{"bool", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redactValue(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactValue(%#v) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+	if labels["owner"] != "a@b.com" {
+		t.Errorf("shared labels modified: %v", labels)
+	}
+}
+
+func TestRedactDecodedJSON(t *testing.T) {
+	chain, err := New(module.CollectConf{Decoder: "json", Redact: []string{"all"}}, func(msg *module.TextMsg) {
+		data := msg.Value()
+		want := `{"card":"****************","phone":"***********","text":"*******"}`
+		if data != want {
+			t.Errorf("value = %s, want %s", data, want)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Process(&module.TextMsg{Msg: `{"phone":13812345678,"card":4111111111111111,"text":"a@b.com"}`})
+}
@@ -0,0 +1,66 @@
+package process
+
+import (
+	"fmt"
+	"logagent/metrics"
+	"logagent/module"
+	"regexp"
+	"strings"
+)
+
+//routeRule 字段匹配正则时发送到对应的topic
+type routeRule struct {
+	field string
+	re    *regexp.Regexp
+	topic string
+}
+
+//parseRouteRule 格式为field=regex:topic,比如k8s_namespace=^prod-:prod_log
+func parseRouteRule(rule string) (*routeRule, error) {
+	pos := strings.LastIndex(rule, ":")
+	eq := strings.Index(rule, "=")
+	if pos < 0 || eq <= 0 || eq > pos {
+		return nil, fmt.Errorf("invalid route rule %q, want field=regex:topic", rule)
+	}
+	topic := strings.TrimSpace(rule[pos+1:])
+	if len(topic) == 0 {
+		return nil, fmt.Errorf("invalid topic in route rule %q", rule)
+	}
+	re, err := regexp.Compile(rule[eq+1 : pos])
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp in route rule %q:%v", rule, err)
+	}
+	return &routeRule{field: strings.TrimSpace(rule[:eq]), re: re, topic: topic}, nil
+}
+
+//router 按topic_routes修改消息的topic,第一条匹配的规则生效,都不匹配时保持原来的topic
+type router struct {
+	task  string
+	rules []*routeRule
+}
+
+func newRouter(conf module.CollectConf) (*router, error) {
+	r := &router{task: conf.Name}
+	for _, v := range conf.TopicRoutes {
+		if len(strings.TrimSpace(v)) == 0 {
+			continue
+		}
+		rule, err := parseRouteRule(v)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+func (r *router) Process(msg *module.TextMsg) bool {
+	for _, rule := range r.rules {
+		if v, ok := fieldString(msg, rule.field); ok && rule.re.MatchString(v) {
+			msg.Topic = rule.topic
+			metrics.Inc("route."+r.task+"."+rule.topic, 1)
+			return true
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package process
+
+import (
+	"logagent/module"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	r, err := newRouter(module.CollectConf{Name: "t", TopicRoutes: []string{
+		"k8s_namespace=^prod-:prod_log",
+		" ",
+		//正则里可以有冒号,按最后一个冒号分隔topic
+		"message=level:(error|fatal):error_log",
+		"k8s_namespace=.*:other_log",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		msg   *module.TextMsg
+		topic string
+	}{
+		{"first match wins", &module.TextMsg{Msg: "level:error", Fields: map[string]interface{}{"k8s_namespace": "prod-api"}}, "prod_log"},
+		{"match message", &module.TextMsg{Msg: "level:fatal boom"}, "error_log"},
+		{"fallback rule", &module.TextMsg{Msg: "ok", Fields: map[string]interface{}{"k8s_namespace": "dev"}}, "other_log"},
+		{"no match keeps topic", &module.TextMsg{Msg: "ok"}, "app"},
+	}
+	for _, tt := range tests {
+		if tt.msg.Topic == "" {
+			tt.msg.Topic = "app"
+		}
+		if !r.Process(tt.msg) || tt.msg.Topic != tt.topic {
+			t.Errorf("%s: topic = %s, want %s", tt.name, tt.msg.Topic, tt.topic)
+		}
+	}
+}
+
+func TestParseRouteRuleErrors(t *testing.T) {
+	for _, rule := range []string{"no_topic", "=^a:topic", "field=^a: ", "field:topic=x", "field=(:topic"} {
+		if _, err := parseRouteRule(rule); err == nil {
+			t.Errorf("parseRouteRule(%q) should fail", rule)
+		}
+	}
+}
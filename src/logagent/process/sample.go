@@ -0,0 +1,309 @@
+package process
+
+import (
+	"fmt"
+	"hash/fnv"
+	"logagent/module"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//sampleRule 字段匹配正则时使用对应的采样率
+type sampleRule struct {
+	field string
+	re    *regexp.Regexp
+	rate  float64
+}
+
+//parseSampleRule 格式为field=regex:rate,比如status=^2:0.1
+func parseSampleRule(rule string) (*sampleRule, error) {
+	pos := strings.LastIndex(rule, ":")
+	eq := strings.Index(rule, "=")
+	if pos < 0 || eq <= 0 || eq > pos {
+		return nil, fmt.Errorf("invalid sample rule %q, want field=regex:rate", rule)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rule[pos+1:]), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("invalid sample rate in rule %q", rule)
+	}
+	re, err := regexp.Compile(rule[eq+1 : pos])
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp in sample rule %q:%v", rule, err)
+	}
+	return &sampleRule{field: strings.TrimSpace(rule[:eq]), re: re, rate: rate}, nil
+}
+
+//sampler 按比例保留消息,配置了sample_key时按key的哈希决定,同一个key的结果一致
+type sampler struct {
+	task  string
+	rate  float64
+	rules []*sampleRule
+	key   string
+	hash  bool
+
+	lk  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newSampler(conf module.CollectConf) (*sampler, error) {
+	s := &sampler{
+		task: conf.Name,
+		rate: 1,
+		key:  conf.SampleKey,
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	//未配置时全部保留,配置为0时全部丢弃
+	if conf.SampleRate != nil {
+		s.rate = *conf.SampleRate
+	}
+	if s.rate < 0 || s.rate > 1 {
+		return nil, fmt.Errorf("invalid sample_rate:%v", s.rate)
+	}
+	switch conf.SampleMode {
+	case "", "random":
+	case "hash":
+		if len(s.key) == 0 {
+			return nil, fmt.Errorf("sample_key is required for hash sampling")
+		}
+		s.hash = true
+	default:
+		return nil, fmt.Errorf("invalid sample_mode:%s", conf.SampleMode)
+	}
+	for _, r := range conf.SampleRules {
+		if len(strings.TrimSpace(r)) == 0 {
+			continue
+		}
+		rule, err := parseSampleRule(r)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, rule)
+	}
+	return s, nil
+}
+
+func (s *sampler) rateFor(msg *module.TextMsg) float64 {
+	for _, r := range s.rules {
+		if v, ok := fieldString(msg, r.field); ok && r.re.MatchString(v) {
+			return r.rate
+		}
+	}
+	return s.rate
+}
+
+func (s *sampler) Process(msg *module.TextMsg) bool {
+	rate := s.rateFor(msg)
+	if rate >= 1 {
+		return true
+	}
+
+	var keep bool
+	if v, ok := fieldString(msg, s.key); s.hash && ok {
+		h := fnv.New32a()
+		h.Write([]byte(v))
+		keep = float64(h.Sum32()%10000) < rate*10000
+	} else {
+		s.lk.Lock()
+		keep = s.rnd.Float64() < rate
+		s.lk.Unlock()
+	}
+	if !keep {
+		dropped(s.task, "sample")
+	}
+	return keep
+}
+
+//fieldString 取字段的字符串值,message字段在没有解析时取原始行
+func fieldString(msg *module.TextMsg, field string) (string, bool) {
+	if len(field) == 0 {
+		return "", false
+	}
+	if v, ok := msg.Fields[field]; ok {
+		return fmt.Sprint(v), true
+	}
+	if field == "message" {
+		return msg.Msg, true
+	}
+	return "", false
+}
+
+//tokenBucket 令牌桶,rate为每秒生成的令牌数
+type tokenBucket struct {
+	lk     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+//take 令牌足够时扣除并返回0,否则返回需要等待的时间
+//超过桶容量的请求在桶满时放行,避免永远等不到
+func (b *tokenBucket) take(n float64, consume bool) time.Duration {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.refill(time.Now())
+
+	need := n
+	if need > b.burst {
+		need = b.burst
+	}
+	if b.tokens >= need {
+		b.tokens -= n
+		return 0
+	}
+	if !consume {
+		return -1
+	}
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+//limiter 按行数和字节数限速,block模式下阻塞读取,drop模式下丢弃并计数
+type limiter struct {
+	task  string
+	lines *tokenBucket
+	bytes *tokenBucket
+	block bool
+}
+
+func newLimiter(conf module.CollectConf) (*limiter, error) {
+	l := &limiter{task: conf.Name}
+	switch conf.RateMode {
+	case "", "block":
+		l.block = true
+	case "drop":
+	default:
+		return nil, fmt.Errorf("invalid rate_mode:%s", conf.RateMode)
+	}
+	if conf.RateLines > 0 {
+		l.lines = newTokenBucket(float64(conf.RateLines))
+	}
+	if conf.RateBytes > 0 {
+		l.bytes = newTokenBucket(float64(conf.RateBytes))
+	}
+	return l, nil
+}
+
+func (l *limiter) Process(msg *module.TextMsg) bool {
+	if !l.allow(l.lines, 1, "rate_lines") {
+		return false
+	}
+	return l.allow(l.bytes, float64(len(msg.Msg)), "rate_bytes")
+}
+
+func (l *limiter) allow(b *tokenBucket, n float64, reason string) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		wait := b.take(n, l.block)
+		if wait == 0 {
+			return true
+		}
+		if wait < 0 {
+			dropped(l.task, reason)
+			return false
+		}
+		time.Sleep(wait)
+	}
+}
+
+//RateLimit 按行数和字节数限速,输入端给每个连接单独限速时使用,为nil时不限制
+type RateLimit struct {
+	lines *tokenBucket
+	bytes *tokenBucket
+}
+
+//NewRateLimit 每秒最多lines行,bytes字节,都为0时返回nil
+func NewRateLimit(lines, bytes int) *RateLimit {
+	if lines <= 0 && bytes <= 0 {
+		return nil
+	}
+	r := &RateLimit{}
+	if lines > 0 {
+		r.lines = newTokenBucket(float64(lines))
+	}
+	if bytes > 0 {
+		r.bytes = newTokenBucket(float64(bytes))
+	}
+	return r
+}
+
+//Wait 阻塞到一行n字节的数据可以通过
+func (r *RateLimit) Wait(n int) {
+	if r == nil {
+		return
+	}
+	r.lines.wait(1)
+	r.bytes.wait(float64(n))
+}
+
+//Allow 不阻塞,超出限制时返回false
+func (r *RateLimit) Allow(n int) bool {
+	if r == nil {
+		return true
+	}
+	if r.lines != nil && r.lines.take(1, false) != 0 {
+		return false
+	}
+	return r.bytes == nil || r.bytes.take(float64(n), false) == 0
+}
+
+//AllowN 不阻塞,一批lines行bytes字节全部可以通过时扣除并返回true,否则不扣除任何令牌
+func (r *RateLimit) AllowN(lines, bytes int) bool {
+	if r == nil {
+		return true
+	}
+	if !r.lines.enough(float64(lines)) || !r.bytes.enough(float64(bytes)) {
+		return false
+	}
+	if r.lines != nil {
+		r.lines.take(float64(lines), false)
+	}
+	if r.bytes != nil {
+		r.bytes.take(float64(bytes), false)
+	}
+	return true
+}
+
+//enough 令牌是否足够,不扣除,nil时总是足够
+func (b *tokenBucket) enough(n float64) bool {
+	if b == nil {
+		return true
+	}
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.refill(time.Now())
+	if n > b.burst {
+		n = b.burst
+	}
+	return b.tokens >= n
+}
+
+func (b *tokenBucket) wait(n float64) {
+	if b == nil {
+		return
+	}
+	for {
+		wait := b.take(n, true)
+		if wait == 0 {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,119 @@
+package process
+
+import (
+	"fmt"
+	"logagent/module"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  module.CollectConf
+		msg   *module.TextMsg
+		kept  int
+		total int
+	}{
+		{"unset keeps all", module.CollectConf{}, &module.TextMsg{Msg: "x"}, 100, 100},
+		{"rate 1 keeps all", module.CollectConf{SampleRate: floatPtr(1)}, &module.TextMsg{Msg: "x"}, 100, 100},
+		{"rate 0 drops all", module.CollectConf{SampleRate: floatPtr(0)}, &module.TextMsg{Msg: "x"}, 0, 100},
+		{
+			"rule overrides rate 0",
+			module.CollectConf{SampleRate: floatPtr(0), SampleRules: []string{"level=^error$:1"}},
+			&module.TextMsg{Fields: map[string]interface{}{"level": "error"}},
+			100, 100,
+		},
+		{
+			"rule 0 drops matching",
+			module.CollectConf{SampleRules: []string{"message=health:0"}},
+			&module.TextMsg{Msg: "GET /health"},
+			0, 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSampler(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := 0
+			for i := 0; i < tt.total; i++ {
+				if s.Process(tt.msg) {
+					kept++
+				}
+			}
+			if kept != tt.kept {
+				t.Errorf("kept %d of %d, want %d", kept, tt.total, tt.kept)
+			}
+		})
+	}
+}
+
+func TestSamplerHash(t *testing.T) {
+	s, err := newSampler(module.CollectConf{SampleRate: floatPtr(0.5), SampleMode: "hash", SampleKey: "trace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		msg := &module.TextMsg{Fields: map[string]interface{}{"trace": fmt.Sprintf("id-%d", i)}}
+		first := s.Process(msg)
+		for j := 0; j < 3; j++ {
+			if s.Process(msg) != first {
+				t.Fatalf("trace id-%d sampled inconsistently", i)
+			}
+		}
+		if first {
+			kept++
+		}
+	}
+	if kept < 400 || kept > 600 {
+		t.Errorf("kept %d of 1000 with rate 0.5", kept)
+	}
+}
+
+func TestSamplerConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf module.CollectConf
+	}{
+		{"negative rate", module.CollectConf{SampleRate: floatPtr(-0.1)}},
+		{"rate above 1", module.CollectConf{SampleRate: floatPtr(1.5)}},
+		{"hash without key", module.CollectConf{SampleMode: "hash"}},
+		{"unknown mode", module.CollectConf{SampleMode: "first"}},
+		{"bad rule", module.CollectConf{SampleRules: []string{"level:0.1"}}},
+		{"bad rule rate", module.CollectConf{SampleRules: []string{"level=x:2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSampler(tt.conf); err == nil {
+				t.Error("expect error")
+			}
+		})
+	}
+}
+
+//TestRateLimitAllowN 一批不能全部通过时不扣除令牌
+func TestRateLimitAllowN(t *testing.T) {
+	r := NewRateLimit(10, 100)
+	if !r.AllowN(6, 60) {
+		t.Fatal("first batch should pass")
+	}
+	if r.AllowN(5, 10) {
+		t.Fatal("batch over line limit should fail")
+	}
+	if r.AllowN(1, 50) {
+		t.Fatal("batch over byte limit should fail")
+	}
+	//失败的批次没有扣除令牌
+	if !r.AllowN(4, 40) {
+		t.Fatal("remaining tokens should be intact")
+	}
+	if !(*RateLimit)(nil).AllowN(100, 100) {
+		t.Fatal("nil limit should allow")
+	}
+}
@@ -0,0 +1,214 @@
+package process
+
+import (
+	"fmt"
+	"logagent/module"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//常用的命名格式
+var namedLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+}
+
+//strftime格式到go格式的对应关系
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'f': "999999999",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'T': "15:04:05",
+	'F': "2006-01-02",
+	'%': "%",
+}
+
+//timestamper 从字段或正则中提取事件时间
+type timestamper struct {
+	field   string
+	regex   *regexp.Regexp
+	group   int
+	parsers []func(string) (time.Time, error)
+	target  string
+}
+
+func newTimestamper(conf module.CollectConf) (*timestamper, error) {
+	t := &timestamper{
+		field:  conf.TimestampField,
+		target: conf.TimestampTarget,
+	}
+	if len(t.target) == 0 {
+		t.target = "@timestamp"
+	}
+
+	if len(conf.TimestampRegex) > 0 {
+		re, err := regexp.Compile(conf.TimestampRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp_regex:%v", err)
+		}
+		t.regex = re
+		if idx := re.SubexpIndex("ts"); idx > 0 {
+			t.group = idx
+		} else if re.NumSubexp() > 0 {
+			t.group = 1
+		}
+	}
+	if len(t.field) == 0 && t.regex == nil {
+		return nil, fmt.Errorf("timestamp_field or timestamp_regex is required")
+	}
+
+	loc := time.Local
+	if len(conf.TimestampTimezone) > 0 {
+		var err error
+		loc, err = time.LoadLocation(conf.TimestampTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp_timezone:%v", err)
+		}
+	}
+
+	if len(conf.TimestampLayouts) == 0 {
+		return nil, fmt.Errorf("timestamp_layouts is required")
+	}
+	for _, layout := range conf.TimestampLayouts {
+		p, err := newTimeParser(strings.TrimSpace(layout), loc)
+		if err != nil {
+			return nil, err
+		}
+		t.parsers = append(t.parsers, p)
+	}
+	return t, nil
+}
+
+//newTimeParser 支持go格式,strftime格式(包含%),命名格式以及unix/unix_ms等时间戳
+func newTimeParser(layout string, loc *time.Location) (func(string) (time.Time, error), error) {
+	switch layout {
+	case "":
+		return nil, fmt.Errorf("empty timestamp layout")
+	case "unix", "epoch":
+		return epochParser(time.Second), nil
+	case "unix_ms", "epoch_millis":
+		return epochParser(time.Millisecond), nil
+	case "unix_us", "epoch_micros":
+		return epochParser(time.Microsecond), nil
+	case "unix_ns", "epoch_nanos":
+		return epochParser(time.Nanosecond), nil
+	}
+
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	} else if strings.Contains(layout, "%") {
+		converted, err := convertStrftime(layout)
+		if err != nil {
+			return nil, err
+		}
+		layout = converted
+	}
+	return func(value string) (time.Time, error) {
+		//不带时区的格式按配置的时区解析
+		return time.ParseInLocation(layout, value, loc)
+	}, nil
+}
+
+func epochParser(unit time.Duration) func(string) (time.Time, error) {
+	return func(value string) (time.Time, error) {
+		//整数按整数计算,避免浮点误差
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			perSec := int64(time.Second / unit)
+			return time.Unix(n/perSec, n%perSec*int64(unit)), nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec := f * float64(unit) / float64(time.Second)
+		whole := int64(sec)
+		return time.Unix(whole, int64((sec-float64(whole))*float64(time.Second))), nil
+	}
+}
+
+func convertStrftime(layout string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			b.WriteByte(layout[i])
+			continue
+		}
+		i++
+		if i >= len(layout) {
+			return "", fmt.Errorf("invalid strftime layout:%s", layout)
+		}
+		v, ok := strftimeLayouts[layout[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported strftime directive %%%c in %s", layout[i], layout)
+		}
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
+
+//StrftimeLayout 返回一个strftime指令对应的go格式
+func StrftimeLayout(directive byte) (string, bool) {
+	v, ok := strftimeLayouts[directive]
+	return v, ok
+}
+
+func (t *timestamper) extract(msg *module.TextMsg) string {
+	if len(t.field) > 0 {
+		if v, ok := msg.Fields[t.field]; ok {
+			return strings.TrimSpace(fmt.Sprint(v))
+		}
+	}
+	if t.regex != nil {
+		m := t.regex.FindStringSubmatch(msg.Msg)
+		if m != nil {
+			return m[t.group]
+		}
+	}
+	return ""
+}
+
+//Process 解析不出时间时保留消息,由kafka使用发送时间
+func (t *timestamper) Process(msg *module.TextMsg) bool {
+	value := t.extract(msg)
+	if len(value) == 0 {
+		return true
+	}
+	for _, parse := range t.parsers {
+		ts, err := parse(value)
+		if err != nil {
+			continue
+		}
+		msg.Time = ts
+		msg.SetField(t.target, ts.Format(time.RFC3339Nano))
+		break
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"logagent/module"
+	"testing"
+	"time"
+)
+
+func TestTimestamper(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		name    string
+		conf    module.CollectConf
+		msg     *module.TextMsg
+		want    time.Time
+		wantSet bool
+	}{
+		{
+			name: "go layout in field",
+			conf: module.CollectConf{TimestampField: "time", TimestampLayouts: []string{"2006-01-02 15:04:05"}, TimestampTimezone: "UTC"},
+			msg:  &module.TextMsg{Fields: map[string]interface{}{"time": "2024-03-01 10:20:30"}},
+			want: time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC), wantSet: true,
+		},
+		{
+			name: "strftime with zone",
+			conf: module.CollectConf{TimestampRegex: `\[(?P<ts>[^\]]+)\]`, TimestampLayouts: []string{"%d/%b/%Y:%H:%M:%S %z"}},
+			msg:  &module.TextMsg{Msg: `1.2.3.4 - - [01/Mar/2024:10:20:30 +0800] "GET /"`},
+			want: time.Date(2024, 3, 1, 10, 20, 30, 0, shanghai), wantSet: true,
+		},
+		{
+			name: "unix_ms",
+			conf: module.CollectConf{TimestampField: "ts", TimestampLayouts: []string{"unix_ms"}},
+			msg:  &module.TextMsg{Fields: map[string]interface{}{"ts": "1709288430123"}},
+			want: time.Unix(1709288430, 123000000), wantSet: true,
+		},
+		{
+			name: "fallback layout",
+			conf: module.CollectConf{TimestampField: "ts", TimestampLayouts: []string{"unix", "RFC3339"}},
+			msg:  &module.TextMsg{Fields: map[string]interface{}{"ts": "2024-03-01T10:20:30Z"}},
+			want: time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC), wantSet: true,
+		},
+		{
+			name: "unparsable keeps message",
+			conf: module.CollectConf{TimestampField: "ts", TimestampLayouts: []string{"RFC3339"}},
+			msg:  &module.TextMsg{Fields: map[string]interface{}{"ts": "yesterday"}},
+		},
+		{
+			name: "missing field",
+			conf: module.CollectConf{TimestampField: "ts", TimestampLayouts: []string{"RFC3339"}},
+			msg:  &module.TextMsg{Msg: "no time"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := newTimestamper(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ts.Process(tt.msg) {
+				t.Fatal("message dropped")
+			}
+			if tt.wantSet != !tt.msg.Time.IsZero() {
+				t.Fatalf("time set = %v, want %v", !tt.msg.Time.IsZero(), tt.wantSet)
+			}
+			if tt.wantSet {
+				if !tt.msg.Time.Equal(tt.want) {
+					t.Errorf("time = %v, want %v", tt.msg.Time, tt.want)
+				}
+				if tt.msg.Fields["@timestamp"] != tt.msg.Time.Format(time.RFC3339Nano) {
+					t.Errorf("@timestamp = %v", tt.msg.Fields["@timestamp"])
+				}
+			}
+		})
+	}
+}
+
+func TestTimestamperConfigErrors(t *testing.T) {
+	tests := []module.CollectConf{
+		{TimestampLayouts: []string{"RFC3339"}},
+		{TimestampField: "ts"},
+		{TimestampField: "ts", TimestampLayouts: []string{"%Q"}},
+		{TimestampRegex: "(", TimestampLayouts: []string{"RFC3339"}},
+		{TimestampField: "ts", TimestampLayouts: []string{"RFC3339"}, TimestampTimezone: "Nowhere/City"},
+	}
+	for i, conf := range tests {
+		if _, err := newTimestamper(conf); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
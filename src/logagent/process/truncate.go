@@ -0,0 +1,103 @@
+package process
+
+import (
+	"fmt"
+	"logagent/metrics"
+	"logagent/module"
+	"unicode/utf8"
+)
+
+const (
+	maxLineTruncate = "truncate"
+	maxLineSplit    = "split"
+	maxLineDrop     = "drop"
+)
+
+//truncater 处理超过max_line_bytes的行,split时一行拆成多条发出
+//在处理链的最后执行,只限制原始行和message字段,解码出的其他字段不截断
+type truncater struct {
+	task  string
+	max   int
+	mode  string
+	field string
+	emit  func(msg *module.TextMsg)
+}
+
+func newTruncater(conf module.CollectConf) (*truncater, error) {
+	t := &truncater{
+		task:  conf.Name,
+		max:   conf.MaxLineBytes,
+		mode:  conf.MaxLineMode,
+		field: conf.TruncateField,
+	}
+	if len(t.mode) == 0 {
+		t.mode = maxLineTruncate
+	}
+	switch t.mode {
+	case maxLineTruncate, maxLineSplit, maxLineDrop:
+	default:
+		return nil, fmt.Errorf("invalid max_line_mode:%s", t.mode)
+	}
+	if len(t.field) == 0 {
+		t.field = "truncated"
+	}
+	return t, nil
+}
+
+func (t *truncater) SetEmit(emit func(msg *module.TextMsg)) {
+	t.emit = emit
+}
+
+func (t *truncater) Close() {}
+
+func (t *truncater) Process(msg *module.TextMsg) bool {
+	if len(msg.Msg) <= t.max {
+		return true
+	}
+
+	switch t.mode {
+	case maxLineDrop:
+		dropped(t.task, "too_long")
+		return false
+	case maxLineSplit:
+		metrics.Inc("truncate."+t.task+".split", 1)
+		line := msg.Msg
+		for part := 0; len(line) > 0; part++ {
+			n := cutPoint(line, t.max)
+			m := *msg
+			//每一段带上原来的字段
+			m.Fields = nil
+			for k, v := range msg.Fields {
+				m.SetField(k, v)
+			}
+			m.SetMsg(line[:n])
+			m.SetField(t.field, true)
+			m.SetField("split_part", part)
+			t.emit(&m)
+			line = line[n:]
+		}
+		return false
+	}
+
+	metrics.Inc("truncate."+t.task+".truncated", 1)
+	size := len(msg.Msg)
+	msg.SetMsg(msg.Msg[:cutPoint(msg.Msg, t.max)])
+	msg.SetField(t.field, true)
+	msg.SetField("original_bytes", size)
+	return true
+}
+
+//cutPoint 不超过max字节并且不切断utf-8字符的位置
+func cutPoint(s string, max int) int {
+	if len(s) <= max {
+		return len(s)
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	if n == 0 {
+		return max
+	}
+	return n
+}
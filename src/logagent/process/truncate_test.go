@@ -0,0 +1,141 @@
+package process
+
+import (
+	"logagent/module"
+	"strings"
+	"testing"
+)
+
+func TestTruncater(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		line    string
+		forward bool
+		//forward为true时是处理后的文本,split时是拆出的每一段
+		want []string
+	}{
+		{"short", "", "abc", true, []string{"abc"}},
+		{"truncate", "", "abcdefgh", true, []string{"abcde"}},
+		//不切断多字节字符
+		{"truncate utf-8", maxLineTruncate, "ab中文", true, []string{"ab中"}},
+		{"split", maxLineSplit, "abcdefghijkl", false, []string{"abcde", "fghij", "kl"}},
+		{"split utf-8", maxLineSplit, "中文字", false, []string{"中", "文", "字"}},
+		{"drop", maxLineDrop, "abcdefgh", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newTruncater(module.CollectConf{Name: "t", MaxLineBytes: 5, MaxLineMode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &collector{}
+			tr.SetEmit(c.emit)
+			msg := &module.TextMsg{Msg: tt.line, Fields: map[string]interface{}{"message": tt.line, "host": "h1"}}
+			if forward := tr.Process(msg); forward != tt.forward {
+				t.Fatalf("Process = %v, want %v", forward, tt.forward)
+			}
+
+			got := c.list()
+			if tt.forward {
+				got = []*module.TextMsg{msg}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d", len(got), len(tt.want))
+			}
+			for i, m := range got {
+				//每一段都带上原来的字段,message字段和文本一致
+				if m.Msg != tt.want[i] || m.Fields["message"] != tt.want[i] || m.Fields["host"] != "h1" {
+					t.Errorf("message %d = %q fields %v, want %q", i, m.Msg, m.Fields, tt.want[i])
+				}
+				oversize := len(tt.line) > 5
+				if truncated, _ := m.Fields["truncated"].(bool); truncated != oversize {
+					t.Errorf("message %d truncated field = %v", i, m.Fields["truncated"])
+				}
+				if tt.mode == maxLineSplit && m.Fields["split_part"] != i {
+					t.Errorf("message %d split_part = %v", i, m.Fields["split_part"])
+				}
+			}
+			if tt.forward && len(tt.line) > 5 && msg.Fields["original_bytes"] != len(tt.line) {
+				t.Errorf("original_bytes = %v, want %d", msg.Fields["original_bytes"], len(tt.line))
+			}
+		})
+	}
+
+	if _, err := newTruncater(module.CollectConf{MaxLineBytes: 5, MaxLineMode: "cut"}); err == nil {
+		t.Error("expect error for invalid max_line_mode")
+	}
+}
+
+//TestChainTruncateOrder 长度限制在解码和脱敏之后执行
+func TestChainTruncateOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  module.CollectConf
+		line  string
+		check func(t *testing.T, out []*module.TextMsg)
+	}{
+		{
+			//卡号跨越拆分的边界时也能被识别
+			"redact before split",
+			module.CollectConf{MaxLineBytes: 12, MaxLineMode: maxLineSplit, Redact: []string{"card"}},
+			"paid with 4111111111111111 ok",
+			func(t *testing.T, out []*module.TextMsg) {
+				var joined string
+				for _, msg := range out {
+					joined += msg.Msg
+				}
+				if len(out) != 3 || joined != "paid with **************** ok" {
+					t.Errorf("parts = %d, joined %q", len(out), joined)
+				}
+			},
+		},
+		{
+			//超长的json仍然能解码
+			"decode before truncate",
+			module.CollectConf{MaxLineBytes: 10, Decoder: "json", DecodeOnError: onErrorTag},
+			`{"level":"info","text":"` + strings.Repeat("x", 40) + `"}`,
+			func(t *testing.T, out []*module.TextMsg) {
+				if len(out) != 1 {
+					t.Fatalf("got %d messages, want 1", len(out))
+				}
+				if out[0].Fields["level"] != "info" || out[0].Fields["tags"] != nil {
+					t.Errorf("fields = %v", out[0].Fields)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{}
+			chain, err := New(tt.conf, c.emit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain.Process(&module.TextMsg{Msg: tt.line})
+			chain.Close()
+			tt.check(t, c.list())
+		})
+	}
+}
+
+func TestCutPoint(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want int
+	}{
+		{"abc", 5, 3},
+		{"abcdef", 3, 3},
+		{"a中", 2, 1},
+		{"a中", 4, 4},
+		//max不够一个字符时按字节切
+		{"中", 2, 2},
+		{strings.Repeat("x", 10), 10, 10},
+	}
+	for _, tt := range tests {
+		if got := cutPoint(tt.s, tt.max); got != tt.want {
+			t.Errorf("cutPoint(%q, %d) = %d, want %d", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"fmt"
+	"logagent/memory"
+	"logagent/metrics"
+	"logagent/module"
+	"sync"
+	"sync/atomic"
+)
+
+//优先级,数字越大越先发送
+var priorities = map[string]int{
+	"low":    0,
+	"normal": 1,
+	"high":   2,
+}
+
+//Queue 一个收集任务的消息队列,队列满时Put会阻塞读取
+type Queue struct {
+	name     string
+	ch       chan *module.TextMsg
+	weight   int
+	priority int
+	//平滑加权轮询的当前权重
+	current int
+	//有消息但因为优先级低被连续跳过的次数
+	skipped int
+}
+
+//Scheduler 从各个任务队列中按优先级和权重取消息
+type Scheduler struct {
+	lk     sync.Mutex
+	queues []*Queue
+	//每放入一条消息就放入一个令牌,保证Get时一定有消息可取
+	avail chan struct{}
+}
+
+//maxSkips 低优先级队列连续被跳过这么多次后先取一条,避免被繁忙的高优先级任务饿死
+const maxSkips = 100
+
+var (
+	scheduler = &Scheduler{avail: make(chan struct{}, 1<<20)}
+	//已经放入但还没有处理完的消息数
+	pending int64
+)
+
+//Register 注册一个任务队列
+func Register(conf module.CollectConf) (*Queue, error) {
+	priority, ok := priorities[conf.Priority]
+	if !ok {
+		if len(conf.Priority) > 0 {
+			return nil, fmt.Errorf("invalid priority:%s", conf.Priority)
+		}
+		priority = priorities["normal"]
+	}
+	size := conf.QueueSize
+	if size <= 0 {
+		size = 100
+	}
+	q := &Queue{
+		name:     conf.Name,
+		ch:       make(chan *module.TextMsg, size),
+		weight:   conf.Weight,
+		priority: priority,
+	}
+	if q.weight <= 0 {
+		q.weight = 1
+	}
+
+	scheduler.lk.Lock()
+	scheduler.queues = append(scheduler.queues, q)
+	scheduler.lk.Unlock()
+
+	metrics.GaugeFunc("queue."+q.name+".length", func() int64 {
+		return int64(len(q.ch))
+	})
+	return q, nil
+}
+
+//Put 放入一条消息,队列满或者超出内存上限时阻塞
+func (q *Queue) Put(msg *module.TextMsg) {
+	msg.Task = q.name
+	if msg.Ack != nil {
+		msg.Ack.Add()
+	}
+	memory.Acquire(msg.Size())
+	atomic.AddInt64(&pending, 1)
+	q.ch <- msg
+	scheduler.avail <- struct{}{}
+}
+
+//Get 取出一条消息,没有消息时阻塞
+func Get() *module.TextMsg {
+	<-scheduler.avail
+	return scheduler.next()
+}
+
+//Done 消息处理完后调用,释放占用的内存并确认读取进度
+func Done(msg *module.TextMsg) {
+	memory.Release(msg.Size())
+	atomic.AddInt64(&pending, -1)
+	if msg.Ack != nil {
+		msg.Ack.Done()
+	}
+}
+
+//Pending 返回已经放入但还没有处理完的消息数
+func Pending() int64 {
+	return atomic.LoadInt64(&pending)
+}
+
+//next 在有消息的最高优先级队列中做平滑加权轮询,
+//低优先级队列被跳过超过maxSkips次时先从等待最久的队列取一条
+func (s *Scheduler) next() *module.TextMsg {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	top := -1
+	for _, q := range s.queues {
+		if len(q.ch) > 0 && q.priority > top {
+			top = q.priority
+		}
+	}
+
+	var starved *Queue
+	for _, q := range s.queues {
+		if q.priority == top || len(q.ch) == 0 {
+			q.skipped = 0
+			continue
+		}
+		q.skipped++
+		if q.skipped > maxSkips && (starved == nil || q.skipped > starved.skipped) {
+			starved = q
+		}
+	}
+	if starved != nil {
+		starved.skipped = 0
+		return <-starved.ch
+	}
+
+	var best *Queue
+	total := 0
+	for _, q := range s.queues {
+		if q.priority != top || len(q.ch) == 0 {
+			continue
+		}
+		q.current += q.weight
+		total += q.weight
+		if best == nil || q.current > best.current {
+			best = q
+		}
+	}
+	best.current -= total
+	return <-best.ch
+}
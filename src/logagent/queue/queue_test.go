@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"fmt"
+	"logagent/memory"
+	"logagent/module"
+	"testing"
+)
+
+//resetScheduler 每个测试使用新的调度器
+func resetScheduler(t *testing.T) {
+	old := scheduler
+	scheduler = &Scheduler{avail: make(chan struct{}, 1<<20)}
+	t.Cleanup(func() { scheduler = old })
+}
+
+func register(t *testing.T, name, priority string, weight, size int) *Queue {
+	q, err := Register(module.CollectConf{Name: name, Priority: priority, Weight: weight, QueueSize: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+//take 取出n条消息,按任务统计数量
+func take(n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		msg := Get()
+		counts[msg.Task]++
+		Done(msg)
+	}
+	return counts
+}
+
+func TestWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		take    int
+		want    map[string]int
+	}{
+		{"equal", map[string]int{"a": 1, "b": 1}, 40, map[string]int{"a": 20, "b": 20}},
+		{"3:1", map[string]int{"a": 3, "b": 1}, 40, map[string]int{"a": 30, "b": 10}},
+		{"5:3:2", map[string]int{"a": 5, "b": 3, "c": 2}, 100, map[string]int{"a": 50, "b": 30, "c": 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetScheduler(t)
+			for name, weight := range tt.weights {
+				q := register(t, name, "normal", weight, tt.take)
+				for i := 0; i < tt.take; i++ {
+					q.Put(&module.TextMsg{Msg: "x"})
+				}
+			}
+			got := take(tt.take)
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("task %s got %d, want %d (all %v)", name, got[name], want, got)
+				}
+			}
+			take(len(tt.weights)*tt.take - tt.take)
+		})
+	}
+}
+
+//TestPriorityAging 高优先级一直有消息时,低优先级每maxSkips+1次也能取到一条
+func TestPriorityAging(t *testing.T) {
+	resetScheduler(t)
+	const rounds = 5
+	total := rounds * (maxSkips + 1)
+	high := register(t, "high", "high", 1, total)
+	low := register(t, "low", "low", 1, total)
+	for i := 0; i < total; i++ {
+		high.Put(&module.TextMsg{Msg: "h"})
+		low.Put(&module.TextMsg{Msg: "l"})
+	}
+	got := take(total)
+	if got["low"] != rounds || got["high"] != total-rounds {
+		t.Errorf("got %v, want low %d", got, rounds)
+	}
+	//高优先级取完后剩下的都是低优先级
+	if got = take(total); got["low"] != total-rounds || got["high"] != rounds {
+		t.Errorf("got %v after high drained", got)
+	}
+}
+
+func TestPutDone(t *testing.T) {
+	resetScheduler(t)
+	q := register(t, "task", "", 0, 10)
+	if q.weight != 1 || q.priority != priorities["normal"] {
+		t.Errorf("defaults weight %d priority %d", q.weight, q.priority)
+	}
+	baseMem, basePending := memory.Used(), Pending()
+
+	acked := 0
+	var msgs []*module.TextMsg
+	for i := 0; i < 3; i++ {
+		ack := module.NewAck(func() { acked++ })
+		msg := &module.TextMsg{Msg: fmt.Sprintf("line %d", i), Ack: ack}
+		q.Put(msg)
+		//读取方处理完这一行,消息还在队列中不会确认
+		ack.Done()
+		msgs = append(msgs, msg)
+	}
+	var size int64
+	for _, msg := range msgs {
+		size += msg.Size()
+		if msg.Task != "task" {
+			t.Errorf("task = %q", msg.Task)
+		}
+	}
+	if used := memory.Used() - baseMem; used != size || Pending()-basePending != 3 || acked != 0 {
+		t.Fatalf("after Put memory %d (want %d), pending %d, acked %d", used, size, Pending()-basePending, acked)
+	}
+
+	take(3)
+	if memory.Used() != baseMem || Pending() != basePending || acked != 3 {
+		t.Errorf("after Done memory %d, pending %d, acked %d", memory.Used()-baseMem, Pending()-basePending, acked)
+	}
+
+	if _, err := Register(module.CollectConf{Name: "bad", Priority: "urgent"}); err == nil {
+		t.Error("expect error for invalid priority")
+	}
+}
@@ -0,0 +1,291 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatAuto    = "auto"
+	formatRFC3164 = "rfc3164"
+	formatRFC5424 = "rfc5424"
+
+	//没有PRI的消息按user.notice处理
+	defaultPri = 13
+)
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+//级别名称与process中的级别过滤一致
+var severityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+//message 解析后的syslog消息,不存在的部分为空
+type message struct {
+	facility int
+	severity int
+	time     time.Time
+	hostname string
+	appName  string
+	procID   string
+	msgID    string
+	//rfc5424的structured data,sd-id到参数的映射
+	structured map[string]map[string]string
+	text       string
+}
+
+//fields 转换成发送的字段
+func (m *message) fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"message":  m.text,
+		"facility": facilityNames[m.facility],
+		"severity": severityNames[m.severity],
+	}
+	set := func(key, value string) {
+		if len(value) > 0 {
+			fields[key] = value
+		}
+	}
+	set("hostname", m.hostname)
+	set("app_name", m.appName)
+	set("proc_id", m.procID)
+	set("msg_id", m.msgID)
+	if len(m.structured) > 0 {
+		fields["structured_data"] = m.structured
+	}
+	return fields
+}
+
+//parse 解析一条syslog消息,format为auto时按版本号区分rfc3164和rfc5424
+func parse(data string, format string, now time.Time) (*message, error) {
+	data = strings.TrimRight(data, "\r\n\x00")
+	m := &message{}
+	pri, rest, ok := parsePri(data)
+	if !ok {
+		if format == formatRFC5424 {
+			return nil, fmt.Errorf("missing pri")
+		}
+		pri, rest = defaultPri, data
+	}
+	m.facility = pri / 8
+	m.severity = pri % 8
+
+	if format == formatRFC5424 {
+		return m, parse5424(m, rest)
+	}
+	if version, _ := nextField(rest); format == formatAuto && isDigits(version) {
+		//像rfc5424但解析失败时按rfc3164处理
+		if err := parse5424(m, rest); err == nil {
+			return m, nil
+		}
+		m = &message{facility: m.facility, severity: m.severity}
+	}
+	parse3164(m, rest, now)
+	return m, nil
+}
+
+func parsePri(data string) (int, string, bool) {
+	if len(data) < 3 || data[0] != '<' {
+		return 0, data, false
+	}
+	end := strings.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		return 0, data, false
+	}
+	pri, err := strconv.Atoi(data[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, data, false
+	}
+	return pri, data[end+1:], true
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+//nextField 取出以空格分隔的下一个字段
+func nextField(s string) (string, string) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
+//nilValue rfc5424中-表示没有值
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+//parse5424 VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parse5424(m *message, s string) error {
+	var version, ts string
+	version, s = nextField(s)
+	if !isDigits(version) {
+		return fmt.Errorf("invalid version:%s", version)
+	}
+	ts, s = nextField(s)
+	if ts != "-" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp:%s", ts)
+		}
+		m.time = t
+	}
+	var host, app, proc, msgID string
+	host, s = nextField(s)
+	app, s = nextField(s)
+	proc, s = nextField(s)
+	msgID, s = nextField(s)
+	m.hostname = nilValue(host)
+	m.appName = nilValue(app)
+	m.procID = nilValue(proc)
+	m.msgID = nilValue(msgID)
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, "[") {
+		sd, rest, err := parseStructured(s)
+		if err != nil {
+			return err
+		}
+		m.structured = sd
+		s = rest
+	} else if len(s) > 0 {
+		return fmt.Errorf("invalid structured data")
+	}
+	s = strings.TrimPrefix(s, " ")
+	m.text = strings.TrimPrefix(s, "\xef\xbb\xbf")
+	return nil
+}
+
+//parseStructured 解析[id key="value" ...]形式的structured data,值中的\" \\ \]需要转义
+func parseStructured(s string) (map[string]map[string]string, string, error) {
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, s, fmt.Errorf("invalid structured data id")
+		}
+		id := s[:end]
+		params := make(map[string]string)
+		s = s[end:]
+		for {
+			if strings.HasPrefix(s, "]") {
+				s = s[1:]
+				break
+			}
+			if !strings.HasPrefix(s, " ") {
+				return nil, s, fmt.Errorf("invalid structured data element:%s", id)
+			}
+			s = s[1:]
+			eq := strings.Index(s, "=\"")
+			if eq <= 0 {
+				return nil, s, fmt.Errorf("invalid structured data param:%s", id)
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, s, fmt.Errorf("unterminated structured data value:%s", id)
+			}
+			params[name] = value.String()
+		}
+		sd[id] = params
+	}
+	return sd, s, nil
+}
+
+//parse3164 TIMESTAMP HOSTNAME TAG[PID]: MSG,格式不规范时尽量保留原文
+func parse3164(m *message, s string, now time.Time) {
+	s = strings.TrimLeft(s, " ")
+	//Mmm dd hh:mm:ss,没有年份,取离当前最近的一年
+	if len(s) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], now.Location()); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			m.time = t
+			s = strings.TrimLeft(s[len(time.Stamp):], " ")
+		}
+	}
+	if m.time.IsZero() {
+		//有些设备在rfc3164中使用rfc3339时间
+		ts, rest := nextField(s)
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			m.time = t
+			s = rest
+		}
+	}
+
+	//时间后面的第一个字段不像tag时认为是主机名
+	first, rest := nextField(s)
+	if !m.time.IsZero() && len(rest) > 0 && !strings.HasSuffix(first, ":") && !strings.Contains(first, "[") {
+		m.hostname = first
+		s = rest
+	}
+
+	//tag最长32个字符,后面可以跟[pid],以冒号结束
+	i := 0
+	for i < len(s) && i < 32 && isTagChar(s[i]) {
+		i++
+	}
+	if i == 0 {
+		m.text = s
+		return
+	}
+	tag, rest := s[:i], s[i:]
+	var pid string
+	if strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			m.text = s
+			return
+		}
+		pid, rest = rest[1:end], rest[end+1:]
+	}
+	if !strings.HasPrefix(rest, ":") {
+		m.text = s
+		return
+	}
+	m.appName = tag
+	m.procID = pid
+	m.text = strings.TrimPrefix(rest[1:], " ")
+}
+
+func isTagChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '/'
+}
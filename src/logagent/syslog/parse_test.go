@@ -0,0 +1,151 @@
+package syslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		want   message
+	}{
+		//rfc5424 6.5的例子
+		{
+			"rfc5424 example 1",
+			"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - \xef\xbb\xbf'su root' failed for lonvick on /dev/pts/8",
+			formatAuto,
+			message{facility: 4, severity: 2, time: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				hostname: "mymachine.example.com", appName: "su", msgID: "ID47",
+				text: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			"rfc5424 example 2",
+			"<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts.",
+			formatRFC5424,
+			message{facility: 20, severity: 5, time: time.Date(2003, 8, 24, 12, 14, 15, 3000, time.UTC),
+				hostname: "192.0.2.1", appName: "myproc", procID: "8710", text: "%% It's time to make the do-nuts."},
+		},
+		{
+			"rfc5424 example 3 structured data",
+			`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`,
+			formatAuto,
+			message{facility: 20, severity: 5, time: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				hostname: "mymachine.example.com", appName: "evntslog", msgID: "ID47",
+				structured: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+				},
+				text: "An application event log entry..."},
+		},
+		{
+			"rfc5424 example 4 no message",
+			`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"][examplePriority@32473 class="high"]`,
+			formatAuto,
+			message{facility: 20, severity: 5, time: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				hostname: "mymachine.example.com", appName: "evntslog", msgID: "ID47",
+				structured: map[string]map[string]string{
+					"exampleSDID@32473":     {"iut": "3"},
+					"examplePriority@32473": {"class": "high"},
+				}},
+		},
+		{
+			"rfc5424 escaped param",
+			`<14>1 - - - - - [id a="x\"y\]z\\"] msg`,
+			formatRFC5424,
+			message{facility: 1, severity: 6, structured: map[string]map[string]string{"id": {"a": `x"y]z\`}}, text: "msg"},
+		},
+		//rfc3164 5.4的例子
+		{
+			"rfc3164 example 1",
+			"<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8\n",
+			formatAuto,
+			message{facility: 4, severity: 2, time: time.Date(2023, 10, 11, 22, 14, 15, 0, time.UTC),
+				hostname: "mymachine", appName: "su", text: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			"rfc3164 example 2 no tag",
+			"<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!",
+			formatRFC3164,
+			message{facility: 1, severity: 5, time: time.Date(2023, 2, 5, 17, 32, 18, 0, time.UTC),
+				hostname: "10.0.0.99", text: "Use the BFG!"},
+		},
+		{
+			"rfc3164 pid",
+			"<30>Dec 31 23:59:59 host sshd[123]: Accepted publickey",
+			formatAuto,
+			message{facility: 3, severity: 6, time: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				hostname: "host", appName: "sshd", procID: "123", text: "Accepted publickey"},
+		},
+		{
+			"rfc3164 rfc3339 timestamp",
+			"<30>2024-01-01T00:00:00Z host app: started",
+			formatAuto,
+			message{facility: 3, severity: 6, time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				hostname: "host", appName: "app", text: "started"},
+		},
+		{
+			//版本号后面不是rfc5424时按rfc3164保留原文
+			"auto fallback",
+			"<13>1 not a timestamp",
+			formatAuto,
+			message{facility: 1, severity: 5, text: "1 not a timestamp"},
+		},
+		//PRI不合法时按user.notice处理,保留全部内容
+		{"pri out of range", "<192>hello", formatAuto, message{facility: 1, severity: 5, text: "<192>hello"}},
+		{"pri not number", "<ab>hello", formatAuto, message{facility: 1, severity: 5, text: "<ab>hello"}},
+		{"pri empty", "<>hello", formatAuto, message{facility: 1, severity: 5, text: "<>hello"}},
+		{"pri unterminated", "<13 hello", formatRFC3164, message{facility: 1, severity: 5, text: "<13 hello"}},
+		{"no pri", "plain text", formatAuto, message{facility: 1, severity: 5, text: "plain text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(tt.data, tt.format, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.time.Equal(tt.want.time) {
+				t.Errorf("time = %v, want %v", got.time, tt.want.time)
+			}
+			got.time, tt.want.time = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parse(%q) = %+v, want %+v", tt.data, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"no pri",
+		"<999>1 - - - - - - x",
+		"<13>x 2003-10-11T22:14:15Z h a p m - x",
+		"<13>1 yesterday h a p m - x",
+		"<13>1 - h a p m {bad} x",
+		`<13>1 - h a p m [id a="unterminated] x`,
+		`<13>1 - h a p m [id a=x] x`,
+	} {
+		if _, err := parse(data, formatRFC5424, time.Now()); err == nil {
+			t.Errorf("parse(%q) should fail in rfc5424 mode", data)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	m := &message{facility: 16, severity: 3, hostname: "h", appName: "app", text: "x",
+		structured: map[string]map[string]string{"id": {"k": "v"}}}
+	want := map[string]interface{}{
+		"message":         "x",
+		"facility":        "local0",
+		"severity":        "err",
+		"hostname":        "h",
+		"app_name":        "app",
+		"structured_data": map[string]map[string]string{"id": {"k": "v"}},
+	}
+	if got := m.fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"logagent/metrics"
+	"logagent/module"
+	"logagent/process"
+	"logagent/queue"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//udp报文的最大长度
+	maxPacketSize = 64 * 1024
+)
+
+//input 一个syslog收集任务
+type input struct {
+	conf  module.CollectConf
+	lk    sync.Mutex
+	chain *process.Chain
+}
+
+//InitSyslog 为input为syslog的收集任务启动监听
+func InitSyslog(config *module.Config) error {
+	for _, v := range config.Collect {
+		if v.Input != "syslog" {
+			continue
+		}
+		switch v.SyslogFormat {
+		case formatAuto, formatRFC3164, formatRFC5424:
+		default:
+			return fmt.Errorf("invalid syslog_format:%s", v.SyslogFormat)
+		}
+		q, err := queue.Register(v)
+		if err != nil {
+			logs.Error("register queue failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		chain, err := process.New(v, q.Put)
+		if err != nil {
+			logs.Error("init process chain failed,task:%s,err:%v", v.Name, err)
+			return err
+		}
+		in := &input{conf: v, chain: chain}
+		if err = in.listen(); err != nil {
+			logs.Error("listen syslog failed,task:%s,listen:%s,err:%v", v.Name, v.Listen, err)
+			return err
+		}
+		logs.Info("syslog input listen on %s,task:%s", v.Listen, v.Name)
+	}
+	return nil
+}
+
+//listen 按地址的协议启动监听,支持udp,tcp,unix和unixgram
+func (in *input) listen() error {
+	network, addr, err := splitAddr(in.conf.Listen)
+	if err != nil {
+		return err
+	}
+	if network == "unix" || network == "unixgram" {
+		//删除上次退出时残留的socket文件
+		os.Remove(addr)
+	}
+
+	switch network {
+	case "udp", "unixgram":
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		go in.servePacket(conn)
+	case "tcp", "unix":
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		go in.serveStream(ln)
+	default:
+		return fmt.Errorf("unsupported network:%s", network)
+	}
+	return nil
+}
+
+//splitAddr 把udp://0.0.0.0:514形式的地址拆成协议和地址
+func splitAddr(listen string) (string, string, error) {
+	i := strings.Index(listen, "://")
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid listen address:%s", listen)
+	}
+	return listen[:i], listen[i+3:], nil
+}
+
+func (in *input) servePacket(conn net.PacketConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			logs.Error("read syslog packet failed,task:%s,err:%v", in.conf.Name, err)
+			return
+		}
+		source := in.conf.Listen
+		if addr != nil {
+			source = addr.String()
+		}
+		in.process(string(buf[:n]), source)
+	}
+}
+
+func (in *input) serveStream(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			logs.Error("accept syslog connection failed,task:%s,err:%v", in.conf.Name, err)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go in.serveConn(conn)
+	}
+}
+
+//serveConn 读取一个连接上的消息,每条消息可以是octet-counting或者换行分隔
+func (in *input) serveConn(conn net.Conn) {
+	defer conn.Close()
+	source := conn.RemoteAddr().String()
+	if len(source) == 0 || source == "@" {
+		source = in.conf.Listen
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader, in.maxMessage())
+		if len(frame) > 0 {
+			in.process(frame, source)
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			logs.Warn("read syslog stream failed,task:%s,remote:%s,err:%v", in.conf.Name, source, err)
+			return
+		}
+	}
+}
+
+//maxMessage 单条消息的最大长度,没有配置时与udp报文一致
+func (in *input) maxMessage() int {
+	if in.conf.MaxMessageBytes > 0 {
+		return in.conf.MaxMessageBytes
+	}
+	return maxPacketSize
+}
+
+//readFrame 读取一条消息,以数字开头时按rfc6587的octet-counting读取指定长度,
+//长度在分配内存之前检查,换行分隔的消息读到超过max时就返回错误,不等换行
+func readFrame(reader *bufio.Reader, max int) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		n := 0
+		for {
+			c, err := reader.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' {
+				return "", fmt.Errorf("invalid octet count")
+			}
+			n = n*10 + int(c-'0')
+			if n > max {
+				return "", fmt.Errorf("octet count exceeds max_message_bytes %d", max)
+			}
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			return "", fmt.Errorf("message exceeds max_message_bytes %d", max)
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		return string(line), err
+	}
+}
+
+func (in *input) process(data, source string) {
+	m, err := parse(data, in.conf.SyslogFormat, time.Now())
+	if err != nil {
+		logs.Warn("parse syslog message failed,task:%s,source:%s,err:%v", in.conf.Name, source, err)
+		metrics.Inc("syslog."+in.conf.Name+".parse_errors", 1)
+		return
+	}
+	metrics.Inc("syslog."+in.conf.Name+".messages", 1)
+	msg := &module.TextMsg{
+		Msg:    m.text,
+		Topic:  in.conf.Topic,
+		Source: source,
+		Fields: m.fields(),
+		Time:   m.time,
+	}
+	//处理链中有状态的processor不支持并发,多个连接依次处理
+	in.lk.Lock()
+	in.chain.Process(msg)
+	in.lk.Unlock()
+}
@@ -0,0 +1,86 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"logagent/module"
+	"logagent/process"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//TestLevelFilter 默认配置下min_level按syslog的severity字段过滤
+func TestLevelFilter(t *testing.T) {
+	conf := module.CollectConf{Name: "syslog", Input: "syslog", Topic: "syslog", SyslogFormat: formatAuto, MinLevel: "warning"}
+	var got []string
+	chain, err := process.New(conf, func(msg *module.TextMsg) {
+		got = append(got, msg.Msg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := &input{conf: conf, chain: chain}
+	for _, line := range []string{
+		"<14>Oct 11 22:14:15 host app: info message",
+		"<11>Oct 11 22:14:15 host app: error message",
+		"<164>1 2003-10-11T22:14:15.003Z host app - - - warning message",
+		"<15>1 2003-10-11T22:14:15.003Z host app - - - debug message",
+	} {
+		in.process(line, "test")
+	}
+	if len(got) != 2 || got[0] != "error message" || got[1] != "warning message" {
+		t.Errorf("forwarded %q, want only the error and warning messages", got)
+	}
+}
+
+//endless 不断返回同一个字节,没有换行,用来确认读取有上限
+type endless byte
+
+func (e endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(e)
+	}
+	return len(p), nil
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.Reader
+		max    int
+		want   []string
+		err    bool
+	}{
+		{"octet counting", strings.NewReader("9 <13>hello11 <13>a\nb c d"), 64, []string{"<13>hello", "<13>a\nb c d"}, false},
+		{"newline", strings.NewReader("<13>a\n<13>b\n<13>c"), 64, []string{"<13>a\n", "<13>b\n", "<13>c"}, false},
+		{"octet count at max", strings.NewReader("5 <13>x"), 5, []string{"<13>x"}, false},
+		{"octet count over max", strings.NewReader("6 <13>xy"), 5, nil, true},
+		//长度超限时不读取消息体,也不会因为数字过长而溢出
+		{"huge octet count", io.MultiReader(strings.NewReader("99999999999999999999 "), endless('x')), 64, nil, true},
+		{"invalid octet count", strings.NewReader("12a <13>x"), 64, nil, true},
+		{"truncated frame", strings.NewReader("10 <13>x"), 64, nil, true},
+		{"line over max", strings.NewReader("<13>0123456789\n"), 8, nil, true},
+		{"line without newline", io.MultiReader(strings.NewReader("<13>"), endless('x')), 1024, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReaderSize(tt.reader, 16)
+			var got []string
+			var err error
+			for {
+				var frame string
+				if frame, err = readFrame(reader, tt.max); err != nil {
+					break
+				}
+				got = append(got, frame)
+			}
+			if tt.err == (err == io.EOF) {
+				t.Errorf("err = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frames = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
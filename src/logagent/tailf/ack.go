@@ -0,0 +1,85 @@
+package tailf
+
+import (
+	"logagent/checkpoint"
+	"logagent/module"
+	"sync"
+)
+
+//trackedLine 一行的位置和处理状态
+type trackedLine struct {
+	offset int64
+	inode  uint64
+	dev    uint64
+	//为false时只确认不推进位置,比如容器日志还有没拼完的长行
+	advance bool
+	done    bool
+}
+
+//offsetTracker 按读取顺序跟踪每一行产生的消息,前面的行都处理完后才推进checkpoint,
+//重启后从没有发送完的行继续读
+type offsetTracker struct {
+	key string
+
+	lk      sync.Mutex
+	pending []*trackedLine
+	closed  bool
+	//不会再有新的行,前面的行都处理完后记录为读完,用于补采的归档
+	finished bool
+}
+
+func newOffsetTracker(key string) *offsetTracker {
+	return &offsetTracker{key: key}
+}
+
+//track 记录读到的一行,返回的Ack由读取方处理完这一行后Done
+func (t *offsetTracker) track(line *Line, advance bool) *module.Ack {
+	tl := &trackedLine{offset: line.Offset, inode: line.Inode, dev: line.Dev, advance: advance}
+	t.lk.Lock()
+	t.pending = append(t.pending, tl)
+	t.lk.Unlock()
+	return module.NewAck(func() {
+		t.done(tl)
+	})
+}
+
+//done 一行的消息都处理完,推进到前面连续处理完的最后一行
+func (t *offsetTracker) done(tl *trackedLine) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	tl.done = true
+	var last *trackedLine
+	n := 0
+	for ; n < len(t.pending) && t.pending[n].done; n++ {
+		if t.pending[n].advance {
+			last = t.pending[n]
+		}
+	}
+	t.pending = append(t.pending[:0], t.pending[n:]...)
+	if last != nil && !t.closed {
+		checkpoint.Set(t.key, checkpoint.Entry{Offset: last.offset, Inode: last.inode, Dev: last.dev})
+	}
+	t.complete()
+}
+
+//finish 读取结束,所有行都处理完后把进度记录为Done
+func (t *offsetTracker) finish() {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.finished = true
+	t.complete()
+}
+
+func (t *offsetTracker) complete() {
+	if t.finished && len(t.pending) == 0 && !t.closed {
+		checkpoint.Set(t.key, checkpoint.Entry{Done: true})
+	}
+}
+
+//close 文件已经删除,删除进度,之后的确认不再记录
+func (t *offsetTracker) close() {
+	t.lk.Lock()
+	t.closed = true
+	checkpoint.Delete(t.key)
+	t.lk.Unlock()
+}
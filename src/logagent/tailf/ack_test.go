@@ -0,0 +1,86 @@
+package tailf
+
+import (
+	"io/ioutil"
+	"logagent/checkpoint"
+	"logagent/module"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	key := "file:/test/tracker.log"
+	tracker := newOffsetTracker(key)
+
+	//第二行先发送完,第一行没有发送完时不推进
+	a1 := tracker.track(&Line{Offset: 10, Inode: 7, Dev: 1}, true)
+	a1.Add()
+	a1.Done()
+	a2 := tracker.track(&Line{Offset: 20, Inode: 7, Dev: 1}, true)
+	a2.Done()
+	if _, ok := checkpoint.Get(key); ok {
+		t.Fatal("checkpoint advanced before first line was delivered")
+	}
+	a1.Done()
+	if e, _ := checkpoint.Get(key); e.Offset != 20 || e.Inode != 7 || e.Dev != 1 {
+		t.Fatalf("checkpoint = %+v, want offset 20 inode 7 dev 1", e)
+	}
+
+	//不推进位置的行只确认
+	a3 := tracker.track(&Line{Offset: 30}, false)
+	a3.Done()
+	if e, _ := checkpoint.Get(key); e.Offset != 20 {
+		t.Fatalf("checkpoint = %d, want 20", e.Offset)
+	}
+
+	//关闭后删除进度,之后的确认不再记录
+	a4 := tracker.track(&Line{Offset: 40}, true)
+	tracker.close()
+	a4.Done()
+	if _, ok := checkpoint.Get(key); ok {
+		t.Fatal("checkpoint recorded after close")
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, []byte("line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode, dev := fileID(info)
+	conf := module.CollectConf{Name: "t"}
+
+	tests := []struct {
+		name   string
+		entry  *checkpoint.Entry
+		offset int64
+		ok     bool
+	}{
+		{"no checkpoint", nil, 0, false},
+		{"same file", &checkpoint.Entry{Offset: 5, Inode: inode, Dev: dev}, 5, true},
+		{"replaced file", &checkpoint.Entry{Offset: 5, Inode: inode + 1, Dev: dev}, 0, true},
+		{"old checkpoint without inode", &checkpoint.Entry{Offset: 5}, 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint.Delete(fileKey(path))
+			if tt.entry != nil {
+				checkpoint.Set(fileKey(path), *tt.entry)
+			}
+			offset, ok := resumeOffset(conf, path)
+			if offset != tt.offset || ok != tt.ok {
+				t.Errorf("resumeOffset = %d, %v, want %d, %v", offset, ok, tt.offset, tt.ok)
+			}
+		})
+	}
+}
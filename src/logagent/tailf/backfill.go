@@ -0,0 +1,209 @@
+package tailf
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"io"
+	"io/ioutil"
+	"logagent/checkpoint"
+	"logagent/metrics"
+	"logagent/process"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//archive 一个待补采的轮转文件
+type archive struct {
+	path string
+	info os.FileInfo
+}
+
+//压缩归档的扩展名,没有压缩的轮转文件可能已经被跟踪读过,不做补采
+var archiveExts = map[string]bool{
+	".gz":   true,
+	".zst":  true,
+	".zstd": true,
+	".lz4":  true,
+}
+
+//findArchives 按修改时间从旧到新列出匹配backfill_pattern的压缩文件
+func findArchives(pattern, live string) ([]archive, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	liveInfo, _ := os.Stat(live)
+
+	var archives []archive
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() || !archiveExts[strings.ToLower(filepath.Ext(p))] {
+			continue
+		}
+		if liveInfo != nil && os.SameFile(info, liveInfo) {
+			continue
+		}
+		archives = append(archives, archive{path: p, info: info})
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].info.ModTime().Before(archives[j].info.ModTime())
+	})
+	return archives, nil
+}
+
+//archiveKey 用文件开头的内容和大小标识归档,logrotate改名后仍然能认出来
+func archiveKey(a archive) (string, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha1.New()
+	if _, err := io.CopyN(h, file, 64*1024); err != nil && err != io.EOF {
+		return "", err
+	}
+	return fmt.Sprintf("archive:%s:%d", hex.EncodeToString(h.Sum(nil)), a.info.Size()), nil
+}
+
+//openArchive 按扩展名解压
+func openArchive(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r = gz
+	case ".zst", ".zstd":
+		dec, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &archiveReader{Reader: dec, close: func() error {
+			dec.Close()
+			return file.Close()
+		}}, nil
+	default:
+		r = lz4.NewReader(file)
+	}
+	return &archiveReader{Reader: r, close: file.Close}, nil
+}
+
+type archiveReader struct {
+	io.Reader
+	close func() error
+}
+
+func (r *archiveReader) Close() error {
+	return r.close()
+}
+
+//backfill 依次读取还没有补采过的归档,每一行发送完后记录读到的位置,
+//所有行都发送完后记录为Done,中途失败或退出时下次从没有发送完的行继续
+func backfill(tailObj *TailObj) {
+	conf := tailObj.conf
+	pattern := conf.BackfillPattern
+	if len(pattern) == 0 {
+		pattern = conf.LogPath + ".*"
+	}
+	archives, err := findArchives(pattern, conf.LogPath)
+	if err != nil {
+		logs.Error("find backfill archives failed,task:%s,pattern:%s,err:%v", conf.Name, pattern, err)
+		return
+	}
+
+	for _, a := range archives {
+		key, err := archiveKey(a)
+		if err != nil {
+			logs.Error("read backfill archive failed,path:%s,err:%v", a.path, err)
+			continue
+		}
+		e, _ := checkpoint.Get(key)
+		if e.Done {
+			continue
+		}
+		if tooOld(conf, a.info) {
+			logs.Debug("skip backfill archive older than ignore_older,task:%s,path:%s", conf.Name, a.path)
+			continue
+		}
+
+		logs.Info("backfill archive start,task:%s,path:%s,offset:%d", conf.Name, a.path, e.Offset)
+		tracker := newOffsetTracker(key)
+		lines, err := readArchive(tailObj, a.path, e.Offset, tracker)
+		if err != nil {
+			logs.Error("backfill archive failed,task:%s,path:%s,lines:%d,err:%v", conf.Name, a.path, lines, err)
+			metrics.Inc("backfill."+conf.Name+".errors", 1)
+			continue
+		}
+		tracker.finish()
+		metrics.Inc("backfill."+conf.Name+".archives", 1)
+		logs.Info("backfill archive done,task:%s,path:%s,lines:%d", conf.Name, a.path, lines)
+	}
+}
+
+//readArchive 从解压后的start位置开始读取,每一行的Offset为解压后这一行结束的位置
+func readArchive(tailObj *TailObj, path string, start int64, tracker *offsetTracker) (int, error) {
+	r, err := openArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	//压缩文件不能seek,跳过已经发送的部分
+	if start > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	reader := bufio.NewReader(r)
+	utf16 := process.IsUTF16(tailObj.conf.Encoding)
+	lines := 0
+	offset := start
+	send := func(text string, end int64) {
+		ack := tracker.track(&Line{Text: text, Offset: end}, true)
+		tailObj.process(text, path, ack)
+		ack.Done()
+		lines++
+	}
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		partial += line
+		for {
+			text, rest, ok := cutLine(partial, utf16)
+			if !ok {
+				break
+			}
+			partial = rest
+			send(text, offset-int64(len(rest)))
+		}
+		if err == io.EOF {
+			//最后没有换行符的半行
+			if len(partial) > 0 {
+				send(partial, offset)
+			}
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
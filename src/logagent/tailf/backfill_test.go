@@ -0,0 +1,198 @@
+package tailf
+
+import (
+	"compress/gzip"
+	"github.com/pierrec/lz4"
+	"io"
+	"io/ioutil"
+	"logagent/checkpoint"
+	"logagent/module"
+	"logagent/process"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+//writeArchive 按扩展名压缩写入,并设置修改时间
+func writeArchive(t *testing.T, path, content string, mtime time.Time) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w io.WriteCloser
+	switch filepath.Ext(path) {
+	case ".gz":
+		w = gzip.NewWriter(file)
+	case ".lz4":
+		w = lz4.NewWriter(file)
+	}
+	if w != nil {
+		_, err = io.WriteString(w, content)
+		if err == nil {
+			err = w.Close()
+		}
+	} else {
+		_, err = io.WriteString(file, content)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	live := filepath.Join(dir, "app.log")
+	now := time.Now()
+	writeArchive(t, live, "live\n", now)
+	//没有压缩的轮转文件可能已经跟踪读过
+	writeArchive(t, live+".1", "plain\n", now.Add(-time.Hour))
+	writeArchive(t, live+".2.gz", "b\n", now.Add(-2*time.Hour))
+	writeArchive(t, live+".3.lz4", "a\n", now.Add(-3*time.Hour))
+	writeArchive(t, live+".4.GZ", "newest\n", now.Add(-time.Minute))
+	os.Mkdir(filepath.Join(dir, "app.log.dir.gz"), 0755)
+
+	archives, err := findArchives(live+".*", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{live + ".3.lz4", live + ".2.gz", live + ".4.GZ"}
+	if len(archives) != len(want) {
+		t.Fatalf("got %d archives, want %v", len(archives), want)
+	}
+	for i, a := range archives {
+		if a.path != want[i] {
+			t.Errorf("archive %d = %s, want %s", i, a.path, want[i])
+		}
+	}
+
+	//轮转文件改名后key不变
+	key, err := archiveKey(archives[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(dir, "renamed.lz4")
+	os.Rename(archives[0].path, renamed)
+	info, _ := os.Stat(renamed)
+	if k, _ := archiveKey(archive{path: renamed, info: info}); k != key {
+		t.Errorf("key changed after rename: %s != %s", k, key)
+	}
+}
+
+//pendingOutput 模拟队列,收到的消息在deliver之前都没有发送完
+type pendingOutput struct {
+	lk   sync.Mutex
+	msgs []*module.TextMsg
+}
+
+func (o *pendingOutput) put(msg *module.TextMsg) {
+	if msg.Ack != nil {
+		msg.Ack.Add()
+	}
+	o.lk.Lock()
+	o.msgs = append(o.msgs, msg)
+	o.lk.Unlock()
+}
+
+//deliver 确认前n条消息
+func (o *pendingOutput) deliver(n int) []string {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	var texts []string
+	for _, msg := range o.msgs[:n] {
+		texts = append(texts, msg.Msg)
+		msg.Ack.Done()
+	}
+	o.msgs = o.msgs[n:]
+	return texts
+}
+
+func testTailObj(t *testing.T, conf module.CollectConf) (*TailObj, *pendingOutput) {
+	out := &pendingOutput{}
+	chain, err := process.New(conf, out.put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &TailObj{conf: conf, chain: chain}, out
+}
+
+//TestBackfillResume 所有行发送完后才记录为Done,没有发送完时下次从没有发送完的行继续
+func TestBackfillResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	live := filepath.Join(dir, "app.log")
+	path := live + ".1.gz"
+	writeArchive(t, path, "one\ntwo\nthree\nfour", time.Now())
+	info, _ := os.Stat(path)
+	key, err := archiveKey(archive{path: path, info: info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Delete(key)
+	conf := module.CollectConf{Name: "t", Topic: "t", LogPath: live, Backfill: true}
+
+	//读完但只发送了前两行,中间的第三行没有确认时不记录后面的位置
+	tailObj, out := testTailObj(t, conf)
+	backfill(tailObj)
+	if e, ok := checkpoint.Get(key); ok {
+		t.Fatalf("checkpoint %+v recorded before delivery", e)
+	}
+	out.deliver(2)
+	if e, _ := checkpoint.Get(key); e.Done || e.Offset != int64(len("one\ntwo\n")) {
+		t.Fatalf("checkpoint = %+v, want offset after two lines", e)
+	}
+
+	//重启后从第三行继续,全部发送完后记录为Done
+	tailObj, out = testTailObj(t, conf)
+	backfill(tailObj)
+	if got := out.deliver(2); len(got) != 2 || got[0] != "three" || got[1] != "four" {
+		t.Fatalf("resumed lines = %q, want three and four", got)
+	}
+	if e, _ := checkpoint.Get(key); !e.Done {
+		t.Fatalf("checkpoint = %+v, want done", e)
+	}
+
+	//已经补采完的归档不再读取
+	tailObj, out = testTailObj(t, conf)
+	backfill(tailObj)
+	if len(out.msgs) != 0 {
+		t.Errorf("archive read again after done: %d lines", len(out.msgs))
+	}
+}
+
+//TestBackfillReadError 读取失败时已经发送的行记录了位置,不会标记为Done
+func TestBackfillReadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	live := filepath.Join(dir, "app.log")
+	path := live + ".1.gz"
+	writeArchive(t, path, "one\ntwo\nthree\n", time.Now())
+	//截掉gzip结尾的校验,解压到最后时报错
+	data, _ := ioutil.ReadFile(path)
+	ioutil.WriteFile(path, data[:len(data)-4], 0644)
+	info, _ := os.Stat(path)
+	key, _ := archiveKey(archive{path: path, info: info})
+	defer checkpoint.Delete(key)
+
+	tailObj, out := testTailObj(t, module.CollectConf{Name: "t", Topic: "t", LogPath: live, Backfill: true})
+	backfill(tailObj)
+	out.deliver(len(out.msgs))
+	if e, _ := checkpoint.Get(key); e.Done || e.Offset != int64(len("one\ntwo\nthree\n")) {
+		t.Errorf("checkpoint = %+v, want offset of the delivered lines and not done", e)
+	}
+}
@@ -0,0 +1,299 @@
+package tailf
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io/ioutil"
+	"logagent/metrics"
+	"logagent/module"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	//重新匹配容器日志文件的间隔
+	rescanInterval = 10 * time.Second
+	//kubelet为每个容器日志建立的软链接,文件名中带有容器id
+	criLinkDir = "/var/log/containers"
+	//没有配置max_line_bytes时,拼接被拆开的长行最多缓存的字节数
+	maxPartialBytes = 1 << 20
+)
+
+//containerFile 一个容器的日志文件
+type containerFile struct {
+	tail *follower
+	//容器信息,每条消息都会带上
+	meta map[string]interface{}
+	//按stream缓存被拆开的长行
+	partial map[string]string
+	//partial占用的内存
+	held lineBuffer
+}
+
+//partialSize 所有stream缓存的字节数
+func (f *containerFile) partialSize() int {
+	size := 0
+	for _, text := range f.partial {
+		size += len(text)
+	}
+	return size
+}
+
+//containerLine docker json-file或cri格式解码后的一行
+type containerLine struct {
+	text    string
+	stream  string
+	time    time.Time
+	partial bool
+}
+
+//decodeDocker {"log":"...\n","stream":"stdout","time":"..."},log不以换行结尾时是被拆开的长行
+func decodeDocker(line string) (containerLine, error) {
+	var v struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &v); err != nil {
+		return containerLine{}, err
+	}
+	cl := containerLine{stream: v.Stream}
+	cl.partial = !strings.HasSuffix(v.Log, "\n")
+	cl.text = strings.TrimSuffix(v.Log, "\n")
+	if len(v.Time) > 0 {
+		t, err := time.Parse(time.RFC3339Nano, v.Time)
+		if err != nil {
+			return cl, err
+		}
+		cl.time = t
+	}
+	return cl, nil
+}
+
+//decodeCRI 2016-10-06T00:17:09.669794202Z stdout F log,P表示被拆开的长行
+func decodeCRI(line string) (containerLine, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return containerLine{}, fmt.Errorf("invalid cri log line")
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return containerLine{}, err
+	}
+	cl := containerLine{stream: parts[1], time: t}
+	//tag可以有多个以:分隔的部分,第一个是P或F
+	cl.partial = strings.SplitN(parts[2], ":", 2)[0] == "P"
+	if len(parts) == 4 {
+		cl.text = parts[3]
+	}
+	return cl, nil
+}
+
+//dockerMeta 从容器目录下的config.v2.json读取容器信息
+func dockerMeta(path string) map[string]interface{} {
+	meta := make(map[string]interface{})
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), "config.v2.json"))
+	if err != nil {
+		logs.Warn("read container config failed,path:%s,err:%v", path, err)
+		meta["container_id"] = filepath.Base(filepath.Dir(path))
+		return meta
+	}
+	var v struct {
+		ID     string
+		Name   string
+		Config struct {
+			Image  string
+			Labels map[string]string
+		}
+	}
+	if err = json.Unmarshal(data, &v); err != nil {
+		logs.Warn("decode container config failed,path:%s,err:%v", path, err)
+	}
+	meta["container_id"] = v.ID
+	meta["container_name"] = strings.TrimPrefix(v.Name, "/")
+	meta["container_image"] = v.Config.Image
+	if len(v.Config.Labels) > 0 {
+		meta["container_labels"] = v.Config.Labels
+	}
+	return meta
+}
+
+//criMeta /var/log/pods/<namespace>_<pod>_<uid>/<container>/<n>.log,
+//容器id从/var/log/containers下指向该文件的软链接中取
+func criMeta(path string, ids map[string]string) map[string]interface{} {
+	namespace, pod, uid, container, ok := podPath(path)
+	meta := map[string]interface{}{
+		"container_name": container,
+	}
+	if ok {
+		meta["k8s_namespace"] = namespace
+		meta["k8s_pod"] = pod
+		meta["k8s_pod_uid"] = uid
+		meta["k8s_container"] = container
+	}
+	if id, ok := ids[path]; ok {
+		meta["container_id"] = id
+	}
+	return meta
+}
+
+//criContainerIDs 读取软链接,返回日志文件到容器id的映射
+func criContainerIDs() map[string]string {
+	ids := make(map[string]string)
+	links, err := filepath.Glob(filepath.Join(criLinkDir, "*.log"))
+	if err != nil {
+		return ids
+	}
+	for _, link := range links {
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		//<pod>_<namespace>_<container>-<id>.log
+		name := strings.TrimSuffix(filepath.Base(link), ".log")
+		if i := strings.LastIndex(name, "-"); i >= 0 {
+			ids[target] = name[i+1:]
+		}
+	}
+	return ids
+}
+
+//readContainers 定时按log_path匹配容器日志,新出现的文件开始跟踪,删除的文件停止跟踪
+func readContainers(tailObj *TailObj) {
+	conf := tailObj.conf
+	var pods *podCache
+	if len(conf.PodList) > 0 {
+		pods = newPodCache(conf.PodList, conf.PodListRefresh)
+	}
+	first := true
+	for {
+		paths, err := filepath.Glob(conf.LogPath)
+		if err != nil {
+			logs.Error("match container logs failed,task:%s,pattern:%s,err:%v", conf.Name, conf.LogPath, err)
+			return
+		}
+		var ids map[string]string
+		if conf.Input == "cri" {
+			ids = criContainerIDs()
+		}
+
+		found := make(map[string]bool)
+		for _, path := range paths {
+			found[path] = true
+			tailObj.lock.Lock()
+			_, ok := tailObj.files[path]
+			tailObj.lock.Unlock()
+			if ok {
+				continue
+			}
+			//启动后新出现的容器从头读,启动时已有的按start_position决定
+			var offset int64
+			if first {
+				offset = startOffset(conf, path)
+			} else if e, ok := resumeOffset(conf, path); ok {
+				offset = e
+			}
+			f := &containerFile{partial: make(map[string]string)}
+			if conf.Input == "docker" {
+				f.meta = dockerMeta(path)
+			} else {
+				f.meta = criMeta(path, ids)
+			}
+			//容器日志是json或者cri格式的文本,编码只作用于解出的内容
+			f.tail = newFollower(path, conf.Name, offset, false, conf.WatchMode, conf.PollInterval)
+			tailObj.lock.Lock()
+			tailObj.files[path] = f
+			tailObj.lock.Unlock()
+			logs.Info("start tail container log,task:%s,path:%s,offset:%d", conf.Name, path, offset)
+			go tailObj.readContainer(path, f, pods)
+		}
+
+		tailObj.lock.Lock()
+		for path, f := range tailObj.files {
+			if found[path] {
+				continue
+			}
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				logs.Info("container log removed,stop tail,task:%s,path:%s", conf.Name, path)
+				f.tail.Stop()
+				delete(tailObj.files, path)
+			}
+		}
+		tailObj.lock.Unlock()
+
+		first = false
+		time.Sleep(rescanInterval)
+	}
+}
+
+//readContainer 解码一个容器日志文件,拆开的长行拼好后再发送
+//配置了pod_list时带上pod的标签,并按topic_annotation指定的annotation选择topic
+func (tailObj *TailObj) readContainer(path string, f *containerFile, pods *podCache) {
+	conf := tailObj.conf
+	decode := decodeDocker
+	if conf.Input == "cri" {
+		decode = decodeCRI
+	}
+	limit := conf.MaxLineBytes
+	if limit <= 0 {
+		limit = maxPartialBytes
+	}
+	tracker := newOffsetTracker(fileKey(path))
+	for line := range f.tail.Lines {
+		cl, err := decode(line.Text)
+		if err != nil {
+			logs.Warn("decode container log failed,task:%s,path:%s,err:%v", conf.Name, path, err)
+			metrics.Inc("container."+conf.Name+".decode_errors", 1)
+			continue
+		}
+		if cl.partial {
+			f.partial[cl.stream] += cl.text
+			//拼接的长度超过上限或者内存不够时不再等后面的片段,已经拼好的部分先发出,
+			//超出max_line_bytes的部分由处理链按max_line_mode处理
+			if len(f.partial[cl.stream]) >= limit {
+				metrics.Inc("container."+conf.Name+".partial_flushed", 1)
+			} else if f.held.resize(f.partialSize()) {
+				continue
+			} else {
+				logs.Warn("memory limit reached,send partial line,task:%s,path:%s,stream:%s", conf.Name, path, cl.stream)
+				metrics.Inc("memory."+conf.Name+".partial_flushed", 1)
+			}
+			cl.text = ""
+		}
+		text := f.partial[cl.stream] + cl.text
+		delete(f.partial, cl.stream)
+		f.held.resize(f.partialSize())
+
+		//还有没拼完的长行时不推进位置,重启时重新拼接
+		ack := tracker.track(line, len(f.partial) == 0)
+		msg := &module.TextMsg{
+			Msg:    text,
+			Topic:  conf.Topic,
+			Source: path,
+			Time:   cl.time,
+			Ack:    ack,
+		}
+		msg.SetField("stream", cl.stream)
+		for k, v := range f.meta {
+			msg.SetField(k, v)
+		}
+		if uid, ok := f.meta["k8s_pod_uid"].(string); ok && pods != nil {
+			if pod := pods.lookup(uid); pod != nil {
+				if len(pod.Metadata.Labels) > 0 {
+					msg.SetField("k8s_labels", pod.Metadata.Labels)
+				}
+				if topic := pod.Metadata.Annotations[conf.TopicAnnotation]; len(conf.TopicAnnotation) > 0 && len(topic) > 0 {
+					msg.Topic = topic
+				}
+			}
+		}
+		tailObj.emit(msg)
+		ack.Done()
+	}
+	//文件已经删除,不再需要读取进度
+	tracker.close()
+	f.held.resize(0)
+}
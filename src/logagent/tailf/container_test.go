@@ -0,0 +1,188 @@
+package tailf
+
+import (
+	"io/ioutil"
+	"logagent/module"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeDocker(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		want containerLine
+		err  bool
+	}{
+		{"complete", `{"log":"hello\n","stream":"stdout","time":"2024-01-02T03:04:05.123456789Z"}`, containerLine{text: "hello", stream: "stdout", time: ts}, false},
+		{"partial", `{"log":"hel","stream":"stdout","time":"2024-01-02T03:04:05.123456789Z"}`, containerLine{text: "hel", stream: "stdout", time: ts, partial: true}, false},
+		{"stderr no time", `{"log":"oops\n","stream":"stderr"}`, containerLine{text: "oops", stream: "stderr"}, false},
+		{"escaped newline", `{"log":"a\\nb\n","stream":"stdout"}`, containerLine{text: `a\nb`, stream: "stdout"}, false},
+		{"invalid json", `{"log":`, containerLine{}, true},
+		{"invalid time", `{"log":"x\n","stream":"stdout","time":"yesterday"}`, containerLine{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeDocker(tt.line)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeDocker = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCRI(t *testing.T) {
+	ts := time.Date(2016, 10, 6, 0, 17, 9, 669794202, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		want containerLine
+		err  bool
+	}{
+		{"full", "2016-10-06T00:17:09.669794202Z stdout F hello world", containerLine{text: "hello world", stream: "stdout", time: ts}, false},
+		{"partial", "2016-10-06T00:17:09.669794202Z stderr P hel", containerLine{text: "hel", stream: "stderr", time: ts, partial: true}, false},
+		{"partial with tags", "2016-10-06T00:17:09.669794202Z stdout P:x:y hel", containerLine{text: "hel", stream: "stdout", time: ts, partial: true}, false},
+		{"empty line", "2016-10-06T00:17:09.669794202Z stdout F", containerLine{stream: "stdout", time: ts}, false},
+		{"too few parts", "2016-10-06T00:17:09.669794202Z stdout", containerLine{}, true},
+		{"invalid time", "yesterday stdout F x", containerLine{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCRI(tt.line)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCRI = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerMeta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	withConfig := filepath.Join(dir, "abc")
+	os.Mkdir(withConfig, 0755)
+	config := `{"ID":"abc","Name":"/web","Config":{"Image":"nginx:1.25","Labels":{"app":"web"}}}`
+	if err := ioutil.WriteFile(filepath.Join(withConfig, "config.v2.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	noConfig := filepath.Join(dir, "def")
+	os.Mkdir(noConfig, 0755)
+
+	tests := []struct {
+		name string
+		path string
+		want map[string]interface{}
+	}{
+		{
+			"config",
+			filepath.Join(withConfig, "abc-json.log"),
+			map[string]interface{}{
+				"container_id":     "abc",
+				"container_name":   "web",
+				"container_image":  "nginx:1.25",
+				"container_labels": map[string]string{"app": "web"},
+			},
+		},
+		//没有config.v2.json时只能从目录名得到容器id
+		{"missing config", filepath.Join(noConfig, "def-json.log"), map[string]interface{}{"container_id": "def"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dockerMeta(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dockerMeta = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCriMeta(t *testing.T) {
+	path := "/var/log/pods/default_web-0_1234/nginx/0.log"
+	ids := map[string]string{path: "c0ffee"}
+	want := map[string]interface{}{
+		"container_name": "nginx",
+		"container_id":   "c0ffee",
+		"k8s_namespace":  "default",
+		"k8s_pod":        "web-0",
+		"k8s_pod_uid":    "1234",
+		"k8s_container":  "nginx",
+	}
+	if got := criMeta(path, ids); !reflect.DeepEqual(got, want) {
+		t.Errorf("criMeta = %v, want %v", got, want)
+	}
+	//路径不是pods目录的格式时只有容器名称
+	want = map[string]interface{}{"container_name": "logs"}
+	if got := criMeta("/data/logs/0.log", ids); !reflect.DeepEqual(got, want) {
+		t.Errorf("criMeta = %v, want %v", got, want)
+	}
+}
+
+//TestReadContainer stdout和stderr交替出现时各自拼接,超过max_line_bytes时先发出
+func TestReadContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lines := []string{
+		"2024-01-02T03:04:05Z stdout P he",
+		"2024-01-02T03:04:05Z stderr P er",
+		"2024-01-02T03:04:05Z stdout F llo",
+		"not a cri line",
+		"2024-01-02T03:04:05Z stderr F ror",
+		"2024-01-02T03:04:05Z stdout P 0123",
+		"2024-01-02T03:04:05Z stdout P 4567",
+		"2024-01-02T03:04:05Z stdout P 89",
+		"2024-01-02T03:04:05Z stdout F ab",
+	}
+	type result struct {
+		text   string
+		stream interface{}
+	}
+	want := []result{
+		{"hello", "stdout"},
+		{"error", "stderr"},
+		{"01234567", "stdout"},
+		{"89ab", "stdout"},
+	}
+
+	conf := module.CollectConf{Name: "t", Topic: "t", Input: "cri", MaxLineBytes: 8}
+	tailObj, out := testTailObj(t, conf)
+	f := &containerFile{
+		tail:    &follower{Lines: make(chan *Line, len(lines))},
+		meta:    map[string]interface{}{"container_name": "app"},
+		partial: make(map[string]string),
+	}
+	for i, text := range lines {
+		f.tail.Lines <- &Line{Text: text, Offset: int64(i+1) * 100}
+	}
+	close(f.tail.Lines)
+	tailObj.readContainer(filepath.Join(dir, "0.log"), f, nil)
+
+	var got []result
+	for _, msg := range out.msgs {
+		got = append(got, result{msg.Msg, msg.Fields["stream"]})
+		if msg.Fields["container_name"] != "app" {
+			t.Errorf("container_name = %v", msg.Fields["container_name"])
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+	if f.held.held != 0 || len(f.partial) != 0 {
+		t.Errorf("partial buffer not released, held:%d, partial:%v", f.held.held, f.partial)
+	}
+}
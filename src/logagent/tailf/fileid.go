@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package tailf
+
+import (
+	"os"
+	"syscall"
+)
+
+//fileID 文件的inode和设备号,取不到时都为0
+func fileID(info os.FileInfo) (inode, dev uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino), uint64(st.Dev)
+	}
+	return 0, 0
+}
@@ -0,0 +1,10 @@
+package tailf
+
+import (
+	"os"
+)
+
+//fileID windows上没有inode,不做检查
+func fileID(info os.FileInfo) (inode, dev uint64) {
+	return 0, 0
+}
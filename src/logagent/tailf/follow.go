@@ -0,0 +1,274 @@
+package tailf
+
+import (
+	"bufio"
+	"github.com/astaxie/beego/logs"
+	"gopkg.in/fsnotify/fsnotify.v1"
+	"io"
+	"logagent/memory"
+	"logagent/metrics"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Line 读到的一行,Offset为这一行结束后在文件中的位置,Inode和Dev标识所在的文件
+type Line struct {
+	Text   string
+	Offset int64
+	Inode  uint64
+	Dev    uint64
+}
+
+//follower 跟踪一个日志文件,按inode和大小识别rename-create和copytruncate两种轮转,
+//rename时先把旧文件读到结尾再切换到新文件
+type follower struct {
+	path string
+	task string
+	//第一次打开文件时的位置
+	start int64
+	//utf-16文件按两个字节对齐的换行切分
+	utf16 bool
+
+	//监听方式,inotify收不到事件时会改为poll
+	lock     sync.Mutex
+	mode     string
+	interval time.Duration
+	notify   *fsnotify.Watcher
+	events   chan struct{}
+	//上次等待是否超时醒来,以及等待前的位置,用来判断inotify事件是否送达
+	timedOut   bool
+	waitOffset int64
+	misses     int
+
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+	//partial占用的内存
+	held lineBuffer
+
+	Lines chan *Line
+	stop  chan struct{}
+}
+
+func newFollower(path, task string, start int64, utf16 bool, mode string, interval time.Duration) *follower {
+	f := &follower{
+		path:     path,
+		task:     task,
+		start:    start,
+		utf16:    utf16,
+		mode:     mode,
+		interval: interval,
+		Lines:    make(chan *Line),
+		stop:     make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+//Stop 停止跟踪,Lines会被关闭
+func (f *follower) Stop() {
+	close(f.stop)
+}
+
+func (f *follower) run() {
+	defer close(f.Lines)
+	defer f.held.resize(0)
+	defer f.closeFile()
+	defer f.stopNotify()
+
+	if f.mode == watchInotify {
+		if err := f.startNotify(); err != nil {
+			logs.Warn("start inotify failed,use poll instead,task:%s,path:%s,err:%v", f.task, f.path, err)
+			metrics.Inc("watch."+f.task+".fallback", 1)
+			f.setMode(watchPoll)
+		}
+	}
+	if !f.open(f.start) {
+		return
+	}
+	for {
+		line, err := f.reader.ReadString('\n')
+		f.offset += int64(len(line))
+		f.partial += line
+		if !f.sendLines() || !f.holdPartial() {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			logs.Error("read file failed,reopen later,path:%s,err:%v", f.path, err)
+			f.closeFile()
+			if !f.wait() || !f.open(f.offset-int64(len(f.partial))) {
+				return
+			}
+			continue
+		}
+
+		//不完整的行先留着,等换行符写入后再发送
+		if !f.checkRotate() {
+			return
+		}
+	}
+}
+
+//checkRotate 读到文件结尾后检查轮转,返回false表示已停止
+func (f *follower) checkRotate() bool {
+	cur, err := f.file.Stat()
+	if err == nil && cur.Size() < f.offset {
+		//copytruncate,文件被截断后从头读
+		logs.Info("log file truncated,task:%s,path:%s,offset:%d,size:%d", f.task, f.path, f.offset, cur.Size())
+		metrics.Inc("rotate."+f.task+".truncated", 1)
+		f.checkMissed(true)
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			logs.Error("seek truncated file failed,path:%s,err:%v", f.path, err)
+		}
+		f.reader.Reset(f.file)
+		f.offset = 0
+		f.partial = ""
+		return true
+	}
+	if err == nil && cur.Size() > f.offset {
+		//当前打开的文件还有数据,轮转后也要先把旧文件读完
+		return true
+	}
+
+	info, err := os.Stat(f.path)
+	if err == nil && !os.SameFile(info, f.info) {
+		//rename-create,旧文件已经读完,剩下的半行也一起发出
+		logs.Info("log file rotated (renamed),task:%s,path:%s,offset:%d", f.task, f.path, f.offset)
+		metrics.Inc("rotate."+f.task+".renamed", 1)
+		f.checkMissed(true)
+		if len(f.partial) > 0 {
+			text := f.partial
+			f.partial = ""
+			if !f.send(text, f.offset) {
+				return false
+			}
+		}
+		f.closeFile()
+		return f.open(0)
+	}
+	f.checkMissed(f.offset != f.waitOffset)
+	f.waitOffset = f.offset
+	return f.wait()
+}
+
+//open 打开文件并定位到offset,文件不存在时等待创建
+func (f *follower) open(offset int64) bool {
+	for {
+		file, err := os.Open(f.path)
+		if err == nil {
+			info, err := file.Stat()
+			if err == nil && offset > info.Size() {
+				//文件比记录的位置还小,说明已经不是原来的文件
+				offset = 0
+			}
+			if err == nil {
+				_, err = file.Seek(offset, io.SeekStart)
+			}
+			if err == nil {
+				f.file = file
+				f.info = info
+				f.offset = offset
+				f.partial = ""
+				f.reader = bufio.NewReader(file)
+				return true
+			}
+			file.Close()
+		}
+		if !os.IsNotExist(err) {
+			logs.Warn("open log file failed,path:%s,err:%v", f.path, err)
+		}
+		if !f.wait() {
+			return false
+		}
+	}
+}
+
+func (f *follower) closeFile() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+//sendLines 发出partial中所有完整的行
+func (f *follower) sendLines() bool {
+	for {
+		text, rest, ok := cutLine(f.partial, f.utf16)
+		if !ok {
+			return true
+		}
+		f.partial = rest
+		if !f.send(text, f.offset-int64(len(rest))) {
+			return false
+		}
+	}
+}
+
+//holdPartial 没有换行的半行计入内存上限,内存不够时不再等换行,先作为一行发出
+func (f *follower) holdPartial() bool {
+	if f.held.resize(len(f.partial)) {
+		return true
+	}
+	logs.Warn("memory limit reached,send partial line,task:%s,path:%s,size:%d", f.task, f.path, len(f.partial))
+	metrics.Inc("memory."+f.task+".partial_flushed", 1)
+	text := f.partial
+	f.partial = ""
+	f.held.resize(0)
+	return f.send(text, f.offset)
+}
+
+//lineBuffer 拼接中的半行占用的内存,读取协程不能阻塞等待,
+//否则多个文件的半行互相占着内存时都等不到释放,申请不到时由调用方先发出已有的部分
+type lineBuffer struct {
+	held int64
+}
+
+//resize 占用调整为n字节,增长时超出上限返回false,占用不变
+func (b *lineBuffer) resize(n int) bool {
+	delta := int64(n) - b.held
+	switch {
+	case delta > 0:
+		if !memory.TryAcquire(delta) {
+			return false
+		}
+	case delta < 0:
+		memory.Release(-delta)
+	}
+	b.held = int64(n)
+	return true
+}
+
+//cutLine 切出第一行,utf16时换行是两个字节对齐的\n\x00或\x00\n,
+//单独的\n字节可能是某个字符的一部分
+func cutLine(buf string, utf16 bool) (line, rest string, ok bool) {
+	if !utf16 {
+		i := strings.IndexByte(buf, '\n')
+		if i < 0 {
+			return "", buf, false
+		}
+		return buf[:i], buf[i+1:], true
+	}
+	for i := 0; i+1 < len(buf); i += 2 {
+		if (buf[i] == '\n' && buf[i+1] == 0) || (buf[i] == 0 && buf[i+1] == '\n') {
+			return buf[:i], buf[i+2:], true
+		}
+	}
+	return "", buf, false
+}
+
+func (f *follower) send(text string, offset int64) bool {
+	inode, dev := fileID(f.info)
+	select {
+	case f.Lines <- &Line{Text: text, Offset: offset, Inode: inode, Dev: dev}:
+		return true
+	case <-f.stop:
+		return false
+	}
+}
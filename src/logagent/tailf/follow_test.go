@@ -0,0 +1,109 @@
+package tailf
+
+import (
+	"io/ioutil"
+	"logagent/memory"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCutLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		buf   string
+		utf16 bool
+		line  string
+		rest  string
+		ok    bool
+	}{
+		{"plain", "abc\ndef", false, "abc", "def", true},
+		{"plain incomplete", "abc", false, "", "abc", false},
+		{"utf-16le lf", "a\x00b\x00\n\x00c\x00", true, "a\x00b\x00", "c\x00", true},
+		{"utf-16be lf", "\x00a\x00\n\x00c", true, "\x00a", "\x00c", true},
+		//U+4E0A的小端编码是0A 4E,不是换行
+		{"utf-16le char with 0a", "\x0a\x4e\x0a\x00", true, "\x0a\x4e", "", true},
+		{"utf-16 unaligned", "a\n\x00", true, "", "a\n\x00", false},
+		{"utf-16le waiting for zero", "a\x00\n", true, "", "a\x00\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, rest, ok := cutLine(tt.buf, tt.utf16)
+			if line != tt.line || rest != tt.rest || ok != tt.ok {
+				t.Errorf("cutLine(%q) = %q, %q, %v, want %q, %q, %v", tt.buf, line, rest, ok, tt.line, tt.rest, tt.ok)
+			}
+		})
+	}
+}
+
+//TestFollowUTF16LastLine utf-16le只以\n结尾的最后一行不需要等下一行写入
+func TestFollowUTF16LastLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	data := "a\x00\n\x00\x0a\x4e\n\x00"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFollower(path, "t", 0, true, watchPoll, 10*time.Millisecond)
+	defer func() {
+		f.Stop()
+		for range f.Lines {
+		}
+	}()
+	want := []Line{{Text: "a\x00", Offset: 4}, {Text: "\x0a\x4e", Offset: 8}}
+	for _, w := range want {
+		select {
+		case line := <-f.Lines:
+			if line.Text != w.Text || line.Offset != w.Offset {
+				t.Errorf("got %q at %d, want %q at %d", line.Text, line.Offset, w.Text, w.Offset)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("line %q not delivered", w.Text)
+		}
+	}
+}
+
+//TestFollowPartialMemory 没有换行的半行计入内存上限,超出时先作为一行发出
+func TestFollowPartialMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, []byte("complete\nno newline yet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := memory.Used()
+	memory.Acquire(10)
+	memory.SetLimit(base + 15)
+	defer func() {
+		memory.SetLimit(0)
+		memory.Release(10)
+	}()
+
+	f := newFollower(path, "t", 0, false, watchPoll, 10*time.Millisecond)
+	for _, want := range []string{"complete", "no newline yet"} {
+		select {
+		case line := <-f.Lines:
+			if line.Text != want {
+				t.Errorf("got %q, want %q", line.Text, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("line %q not delivered", want)
+		}
+	}
+	f.Stop()
+	for range f.Lines {
+	}
+	if used := memory.Used(); used != base+10 {
+		t.Errorf("memory used %d after stop, want %d", used-base, 10)
+	}
+}
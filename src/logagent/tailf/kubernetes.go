@@ -0,0 +1,129 @@
+package tailf
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//找不到pod时触发重新加载,两次加载至少间隔这么久
+	podReloadMin    = 5 * time.Second
+	podFetchTimeout = 5 * time.Second
+)
+
+//podPath 从/var/log/pods/<namespace>_<pod>_<uid>/<container>/N.log中取出pod信息
+func podPath(path string) (namespace, pod, uid, container string, ok bool) {
+	dir := filepath.Dir(path)
+	container = filepath.Base(dir)
+	parts := strings.Split(filepath.Base(filepath.Dir(dir)), "_")
+	if len(parts) != 3 {
+		return "", "", "", container, false
+	}
+	return parts[0], parts[1], parts[2], container, true
+}
+
+//podInfo pod列表中需要的部分
+type podInfo struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		UID         string            `json:"uid"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+//podCache 本地缓存的pod列表,从json文件或kubelet的/pods这样的地址定时加载
+type podCache struct {
+	source  string
+	refresh time.Duration
+	lk      sync.Mutex
+	pods    map[string]*podInfo
+	wake    chan struct{}
+}
+
+func newPodCache(source string, refresh time.Duration) *podCache {
+	c := &podCache{
+		source:  source,
+		refresh: refresh,
+		pods:    make(map[string]*podInfo),
+		wake:    make(chan struct{}, 1),
+	}
+	go c.run()
+	return c
+}
+
+func (c *podCache) run() {
+	for {
+		if err := c.load(); err != nil {
+			logs.Warn("load pod list failed,source:%s,err:%v", c.source, err)
+		}
+		time.Sleep(podReloadMin)
+		select {
+		case <-time.After(c.refresh - podReloadMin):
+		case <-c.wake:
+		}
+	}
+}
+
+func (c *podCache) load() error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(c.source, "http://") || strings.HasPrefix(c.source, "https://") {
+		data, err = fetchPods(c.source)
+	} else {
+		data, err = ioutil.ReadFile(c.source)
+	}
+	if err != nil {
+		return err
+	}
+
+	var list struct {
+		Items []*podInfo `json:"items"`
+	}
+	if err = json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	pods := make(map[string]*podInfo, len(list.Items))
+	for _, p := range list.Items {
+		pods[p.Metadata.UID] = p
+	}
+	c.lk.Lock()
+	c.pods = pods
+	c.lk.Unlock()
+	return nil
+}
+
+func fetchPods(url string) ([]byte, error) {
+	client := &http.Client{Timeout: podFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status:%s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+//lookup 按uid查找pod,找不到时通知重新加载,新建的pod可能还不在缓存中
+func (c *podCache) lookup(uid string) *podInfo {
+	c.lk.Lock()
+	p := c.pods[uid]
+	c.lk.Unlock()
+	if p == nil {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+	return p
+}
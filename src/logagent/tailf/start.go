@@ -0,0 +1,150 @@
+package tailf
+
+import (
+	"bytes"
+	"github.com/astaxie/beego/logs"
+	"io"
+	"logagent/checkpoint"
+	"logagent/module"
+	"logagent/process"
+	"os"
+	"time"
+)
+
+const (
+	//从后往前找换行符时每次读取的大小
+	scanBlock = 64 * 1024
+)
+
+//fileKey 当前跟踪文件在checkpoint中的key
+func fileKey(path string) string {
+	return "file:" + path
+}
+
+//tooOld 文件在ignore_older之内没有修改过
+func tooOld(conf module.CollectConf, info os.FileInfo) bool {
+	return conf.IgnoreOlder > 0 && time.Since(info.ModTime()) > conf.IgnoreOlder
+}
+
+//resumeOffset 有checkpoint时返回记录的位置,记录的inode或者设备号和当前文件不同时,
+//说明停止期间文件被轮转,从头读新文件
+func resumeOffset(conf module.CollectConf, path string) (int64, bool) {
+	e, ok := checkpoint.Get(fileKey(path))
+	if !ok {
+		return 0, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || e.Inode == 0 {
+		return e.Offset, true
+	}
+	if inode, dev := fileID(info); inode != e.Inode || dev != e.Dev {
+		logs.Info("log file replaced since last checkpoint,read from beginning,task:%s,path:%s", conf.Name, path)
+		return 0, true
+	}
+	return e.Offset, true
+}
+
+//startOffset 计算开始读取path的位置,有checkpoint时从记录的位置继续,
+//否则按start_position决定,超过ignore_older没有修改的文件从结尾开始
+func startOffset(conf module.CollectConf, path string) int64 {
+	if offset, ok := resumeOffset(conf, path); ok {
+		return offset
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		//文件还没有创建,创建后从头读
+		return 0
+	}
+	if tooOld(conf, info) {
+		logs.Info("log file not modified within ignore_older,skip old content,task:%s,path:%s,mtime:%v",
+			conf.Name, path, info.ModTime())
+		return info.Size()
+	}
+
+	var offset int64
+	switch conf.StartPosition {
+	case "end":
+		offset = info.Size()
+	case "bytes":
+		offset, err = lastBytesOffset(path, info.Size(), conf.StartLast)
+	case "lines":
+		offset, err = lastLinesOffset(path, info.Size(), conf.StartLast)
+	}
+	if err != nil {
+		logs.Error("compute start position failed,read from beginning,task:%s,path:%s,err:%v", conf.Name, path, err)
+		return 0
+	}
+	//utf-16的字符是两个字节,从奇数位置开始读会错位
+	if process.IsUTF16(conf.Encoding) && offset%2 == 1 {
+		offset++
+	}
+	return offset
+}
+
+//lastBytesOffset 最后n个字节的起始位置,向后对齐到下一行的开头,避免发送半行
+func lastBytesOffset(path string, size, n int64) (int64, error) {
+	if n >= size {
+		return 0, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	//从前一个字节开始找,正好在行首时不用跳过
+	offset := size - n - 1
+	buf := make([]byte, scanBlock)
+	for offset < size {
+		num, err := file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:num], '\n'); i >= 0 {
+			return offset + int64(i) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(num)
+	}
+	return size, nil
+}
+
+//lastLinesOffset 最后n行的起始位置,结尾没有换行符的半行也算一行
+func lastLinesOffset(path string, size, n int64) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, scanBlock)
+	end := size
+	var count int64
+	for end > 0 {
+		start := end - scanBlock
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			//最后一个字节是换行符时,它属于最后一行,不作为分隔
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			count++
+			if count == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
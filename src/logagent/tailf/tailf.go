@@ -3,51 +3,58 @@ package tailf
 import (
 	"fmt"
 	"github.com/astaxie/beego/logs"
-	"github.com/hpcloud/tail"
 	"logagent/module"
-	"time"
+	"logagent/process"
+	"logagent/queue"
+	"sync"
 )
 type TailObj struct {
-	tail *tail.Tail
+	lock sync.Mutex
+	tail *follower
+	//容器日志任务按通配符跟踪多个文件
+	files map[string]*containerFile
 	conf module.CollectConf
-}
-type TextMsg struct {
-	Msg string
-	Topic string
+	//多个文件同时读取时依次进入处理链
+	chainLock sync.Mutex
+	chain *process.Chain
 }
 type TailObjMgr struct {
 	tailObjs []*TailObj
-	msgChan chan *TextMsg
 }
 
 var (
 	tailObjMgr *TailObjMgr
 )
 func InitTail(config *module.Config) error {
-	fmt.Println(config.ChanSize)
 	if len(config.Collect) == 0{
 		err := fmt.Errorf("invalid config for log collect,conf:%v",config.Collect)
 		return err
 	}
-	tailObjMgr = &TailObjMgr{
-		msgChan: make(chan *TextMsg,config.ChanSize),
-	}
+	tailObjMgr = &TailObjMgr{}
 	for _,v := range config.Collect{
-		tails, err := tail.TailFile(v.LogPath, tail.Config{
-			ReOpen:    true,
-			Follow:    true,
-			MustExist: false,
-			Poll:      true,
-		})
+		if v.Input != "file" && v.Input != "docker" && v.Input != "cri" {
+			continue
+		}
+		q, err := queue.Register(v)
+		if err != nil {
+			logs.Error("register queue failed,log_path:%s,err:%v",v.LogPath,err)
+			return err
+		}
+		chain, err := process.New(v, q.Put)
 		if err != nil {
-			fmt.Println("tail file err,err:%v",err)
+			logs.Error("init process chain failed,log_path:%s,err:%v",v.LogPath,err)
 			return err
 		}
 		obj := &TailObj{
 			conf:v,
-			tail:tails,
+			chain:chain,
 		}
 		tailObjMgr.tailObjs = append(tailObjMgr.tailObjs,obj)
+		if v.Input != "file" {
+			obj.files = make(map[string]*containerFile)
+			go readContainers(obj)
+			continue
+		}
 		go readFromTail(obj)
 	}
 
@@ -55,25 +62,83 @@ func InitTail(config *module.Config) error {
 }
 
 func readFromTail(tailObj *TailObj) {
-	for true {
-		msg,ok := <- tailObj.tail.Lines
-		if !ok {
-			logs.Warn("tail file close reopen,filename:%s\n",tailObj.tail.Filename)
-			time.Sleep(100 * time.Millisecond)
+	//先补采轮转出去的归档,再跟踪当前文件
+	if tailObj.conf.Backfill {
+		backfill(tailObj)
+	}
+	conf := tailObj.conf
+	tail := newFollower(conf.LogPath, conf.Name, startOffset(conf, conf.LogPath), process.IsUTF16(conf.Encoding),
+		conf.WatchMode, conf.PollInterval)
+	tailObj.lock.Lock()
+	tailObj.tail = tail
+	tailObj.lock.Unlock()
+
+	tracker := newOffsetTracker(fileKey(conf.LogPath))
+	for msg := range tail.Lines {
+		//消息都发送完后才记录读取位置,重启时从没有发送完的行继续
+		ack := tracker.track(msg, true)
+		tailObj.process(msg.Text, conf.LogPath, ack)
+		ack.Done()
+	}
+	logs.Warn("tail file stopped,filename:%s", tailObj.conf.LogPath)
+}
+
+func (tailObj *TailObj) process(line, source string, ack *module.Ack) {
+	textMsg := &module.TextMsg{
+		Msg: line,
+		Topic: tailObj.conf.Topic,
+		Source: source,
+		Ack: ack,
+	}
+	tailObj.emit(textMsg)
+}
+
+func (tailObj *TailObj) emit(msg *module.TextMsg) {
+	tailObj.chainLock.Lock()
+	tailObj.chain.Process(msg)
+	tailObj.chainLock.Unlock()
+}
+
+//FileStatus 文件采集任务的运行状态
+type FileStatus struct {
+	Task      string `json:"task"`
+	Path      string `json:"path"`
+	WatchMode string `json:"watch_mode"`
+	//还在补采归档文件,尚未开始跟踪
+	Backfilling bool `json:"backfilling"`
+}
+
+//Status 返回所有文件采集任务的状态
+func Status() []FileStatus {
+	var list []FileStatus
+	if tailObjMgr == nil {
+		return list
+	}
+	for _, obj := range tailObjMgr.tailObjs {
+		obj.lock.Lock()
+		if obj.files != nil {
+			for path, f := range obj.files {
+				list = append(list, FileStatus{
+					Task:      obj.conf.Name,
+					Path:      path,
+					WatchMode: f.tail.Mode(),
+				})
+			}
+			obj.lock.Unlock()
 			continue
 		}
-		fmt.Println("msg:",msg.Text)
-		textMsg := &TextMsg{
-			Msg: msg.Text,
-			Topic: tailObj.conf.Topic,
+		st := FileStatus{
+			Task:      obj.conf.Name,
+			Path:      obj.conf.LogPath,
+			WatchMode: obj.conf.WatchMode,
 		}
-		fmt.Println(textMsg)
-		tailObjMgr.msgChan <-textMsg
+		if obj.tail != nil {
+			st.WatchMode = obj.tail.Mode()
+		} else {
+			st.Backfilling = obj.conf.Backfill
+		}
+		obj.lock.Unlock()
+		list = append(list, st)
 	}
-}
-
-func GetOneLine()(msg *TextMsg){
-	msgdata := <- tailObjMgr.msgChan
-	fmt.Println("getmsg:",msgdata)
-	return msgdata
+	return list
 }
@@ -0,0 +1,124 @@
+package tailf
+
+import (
+	"github.com/astaxie/beego/logs"
+	"gopkg.in/fsnotify/fsnotify.v1"
+	"logagent/metrics"
+	"path/filepath"
+	"time"
+)
+
+const (
+	watchInotify = "inotify"
+	watchPoll    = "poll"
+
+	//inotify模式下超过这个时间没有事件也会检查一次文件
+	inotifyCheckInterval = 2 * time.Second
+	//连续多次检查发现文件变化却没有收到事件,认为文件系统不支持inotify
+	inotifyMaxMisses = 2
+)
+
+//startNotify 监听日志文件所在目录,这样文件被删除重建后也能收到事件
+func (f *follower) startNotify() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err = watcher.Add(filepath.Dir(f.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	f.notify = watcher
+	f.events = make(chan struct{}, 1)
+
+	name := filepath.Clean(f.path)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != name {
+					continue
+				}
+				select {
+				case f.events <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logs.Warn("watch log file failed,task:%s,path:%s,err:%v", f.task, f.path, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (f *follower) stopNotify() {
+	if f.notify != nil {
+		f.notify.Close()
+		f.notify = nil
+	}
+}
+
+//checkMissed 检查时发现文件有变化,如果是超时醒来的说明inotify事件没有送达
+func (f *follower) checkMissed(changed bool) {
+	if f.Mode() != watchInotify {
+		return
+	}
+	timedOut := f.timedOut
+	f.timedOut = false
+	if !changed {
+		return
+	}
+	if !timedOut {
+		f.misses = 0
+		return
+	}
+	f.misses++
+	if f.misses < inotifyMaxMisses {
+		return
+	}
+	logs.Warn("inotify events not delivered,fallback to poll,task:%s,path:%s", f.task, f.path)
+	metrics.Inc("watch."+f.task+".fallback", 1)
+	f.stopNotify()
+	f.setMode(watchPoll)
+}
+
+//wait 等待文件变化,返回false表示已停止
+func (f *follower) wait() bool {
+	if f.Mode() == watchInotify {
+		select {
+		case <-f.events:
+			f.timedOut = false
+			return true
+		case <-time.After(inotifyCheckInterval):
+			f.timedOut = true
+			return true
+		case <-f.stop:
+			return false
+		}
+	}
+	select {
+	case <-time.After(f.interval):
+		return true
+	case <-f.stop:
+		return false
+	}
+}
+
+//Mode 返回当前实际使用的监听方式
+func (f *follower) Mode() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.mode
+}
+
+func (f *follower) setMode(mode string) {
+	f.lock.Lock()
+	f.mode = mode
+	f.lock.Unlock()
+}